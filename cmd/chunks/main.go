@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+)
+
+// powers every number of a file with parallel workers and writes the results in the same order
+// usage: chunks [input] [output], without an input a file with the numbers from 1 to 100000 is generated
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // stops every stage if something fails
+
+	input := ""
+	if len(os.Args) > 1 {
+		input = os.Args[1]
+	} else {
+		var err error
+		if input, err = generateInput(100000); err != nil {
+			fmt.Println("ERROR: ", err)
+			return
+		}
+		defer os.Remove(input)
+	}
+	output := os.Stdout
+	if len(os.Args) > 2 {
+		f, err := os.Create(os.Args[2])
+		if err != nil {
+			fmt.Println("ERROR: ", err)
+			return
+		}
+		defer f.Close()
+		output = f
+	}
+	w := bufio.NewWriter(output)
+	defer w.Flush()
+
+	// READ: chunks of about 64KB that never split a line
+	chunks, readErr := pipeline.ReadFile(ctx, input, 64<<10, '\n')
+
+	// PARSE and TRANSFORM: every chunk is handled by one of four workers, the output keeps the input order
+	type result struct {
+		lines []byte
+		err   error
+	}
+	results := pipeline.MapConcurrent(ctx, chunks, 4, func(c pipeline.Chunk) result {
+		var buf bytes.Buffer
+		for _, line := range bytes.Split(c.Data, []byte{'\n'}) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			n, err := strconv.Atoi(string(line))
+			if err != nil {
+				return result{err: fmt.Errorf("offset %d: %w", c.Offset, err)}
+			}
+			buf.WriteString(strconv.Itoa(n * n))
+			buf.WriteByte('\n')
+		}
+		return result{lines: buf.Bytes()}
+	})
+
+	// WRITE
+	err := pipeline.ToWriter(ctx, results, w, func(r result) ([]byte, error) {
+		return r.lines, r.err
+	})
+	if err == nil {
+		err = <-readErr
+	}
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+	}
+}
+
+// generateInput writes the numbers from 1 to n to a temporary file and returns its name
+func generateInput(n int) (string, error) {
+	f, err := os.CreateTemp("", "chunks-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	for i := 1; i <= n; i++ {
+		fmt.Fprintln(w, i)
+	}
+	return f.Name(), w.Flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+)
+
+// streams the powers of the numbers from 1 to n as server-sent events, one every half a second
+// usage: curl -N 'localhost:8080/powers?n=10' (stopping curl cancels the pipeline of the request)
+func main() {
+	http.Handle("/powers", pipeline.Handler(build, func(w http.ResponseWriter) pipeline.SinkFunc[int] {
+		return pipeline.SSESink(w, func(n int) ([]byte, error) {
+			return []byte(strconv.Itoa(n)), nil
+		})
+	}))
+	fmt.Println("listening on :8080")
+	if err := http.ListenAndServe(":8080", nil); err != nil {
+		fmt.Println("ERROR: ", err)
+	}
+}
+
+// build creates the pipeline of a single request
+func build(r *http.Request) (*pipeline.Pipeline[int], error) {
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("n must be a positive number")
+	}
+	return pipeline.New[int]().
+		From(func(ctx context.Context) <-chan int {
+			return pipeline.Take(ctx, func(ctx context.Context) <-chan int {
+				var i int
+				return pipeline.RepeatFn(ctx, func() int { i++; return i })
+			}, n)
+		}).
+		Stage(func(ctx context.Context, n int) (int, error) {
+			select {
+			case <-time.After(500 * time.Millisecond): // a slow computation
+				return n * n, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}), nil
+}
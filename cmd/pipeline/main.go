@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+)
+
+// powers a list of numbers with two workers and prints them using the pipeline builder
+func main() {
+	err := pipeline.New[int]().
+		Source(15, 2, 9, 23, 91).
+		Stage(func(ctx context.Context, n int) (int, error) {
+			return n * n, nil
+		}, pipeline.WithConcurrency(2)).
+		Sink(func(ctx context.Context, n int) error {
+			fmt.Println(n)
+			return nil
+		}).
+		Run(context.Background())
+	if err != nil {
+		fmt.Println("ERROR: ", err)
+	}
+}
@@ -0,0 +1,147 @@
+package async
+
+import (
+	"context"
+	"errors"
+)
+
+// FUTURES AND COMBINATORS
+// A future is a handle to a result computed in another goroutine.
+// The combinators wait for a group of futures: All needs every result, Any the first success
+// and Race the first result, successful or not. None of them stop the futures they don't need,
+// pass a context to Go for that.
+
+// ErrNotDone is returned by Result while the future is still running
+var ErrNotDone = errors.New("async: future not done")
+
+// ErrNoFutures is returned by Any and Race when they are called without futures
+var ErrNoFutures = errors.New("async: no futures")
+
+// Future is the result of a computation running in another goroutine
+type Future[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// Go runs fn in a new goroutine and returns its future
+func Go[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		f.val, f.err = fn(ctx)
+	}()
+	return f
+}
+
+// Done returns a channel that is closed when the result is ready
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the result is ready or the context is done, the computation keeps running in the second case
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Result returns the result without blocking, ErrNotDone if it's not ready yet
+func (f *Future[T]) Result() (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	default:
+		var zero T
+		return zero, ErrNotDone
+	}
+}
+
+// result is a finished future together with its position
+type result[T any] struct {
+	i   int
+	val T
+	err error
+}
+
+// collect sends the result of every future, in the order they finish
+func collect[T any](ctx context.Context, futures []*Future[T]) <-chan result[T] {
+	out := make(chan result[T], len(futures)) // buffered, nobody is left blocked if we stop reading
+	for i, f := range futures {
+		go func() {
+			select {
+			case <-f.done:
+				out <- result[T]{i: i, val: f.val, err: f.err}
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return out
+}
+
+// All waits for every future and returns their results in order, it returns early with the first error
+func All[T any](ctx context.Context, futures ...*Future[T]) ([]T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	res := make([]T, len(futures))
+	results := collect(ctx, futures)
+	for range futures {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				return nil, r.err
+			}
+			res[r.i] = r.val
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return res, nil
+}
+
+// Any returns the first successful result, if every future fails it returns all the errors joined
+func Any[T any](ctx context.Context, futures ...*Future[T]) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var zero T
+	if len(futures) == 0 {
+		return zero, ErrNoFutures
+	}
+	errs := make([]error, 0, len(futures))
+	results := collect(ctx, futures)
+	for range futures {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				return r.val, nil
+			}
+			errs = append(errs, r.err)
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+	return zero, errors.Join(errs...)
+}
+
+// Race returns the result of the first future to finish, successful or not
+func Race[T any](ctx context.Context, futures ...*Future[T]) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var zero T
+	if len(futures) == 0 {
+		return zero, ErrNoFutures
+	}
+	select {
+	case r := <-collect(ctx, futures):
+		return r.val, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
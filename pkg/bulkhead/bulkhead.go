@@ -0,0 +1,70 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/semaphore"
+)
+
+// BULKHEAD
+// A ship is split in watertight compartments so a leak in one of them doesn't sink the whole ship.
+// A bulkhead gives a group of calls (e.g. every stage talking to a slow external API) its own budget
+// of concurrent calls and its own waiting line: when that dependency is saturated its calls wait
+// or fail with ErrFull, but they can't take the goroutines the other parts of the program need.
+
+// ErrFull is returned when every slot is busy and the waiting line is full
+var ErrFull = errors.New("bulkhead: full")
+
+// Bulkhead limits the calls running at the same time and the calls waiting for a slot
+type Bulkhead struct {
+	slots   *semaphore.Weighted
+	queue   int64
+	waiting atomic.Int64
+	running atomic.Int64
+}
+
+// New creates a bulkhead with the given number of slots where up to queue calls can wait for a free slot
+func New(slots, queue int) *Bulkhead {
+	return &Bulkhead{slots: semaphore.New(int64(max(slots, 1))), queue: int64(max(queue, 0))}
+}
+
+// Do calls fn once a slot is free, it returns ErrFull if the waiting line is full
+// or the context error if the context is done while waiting
+func (b *Bulkhead) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := Call(ctx, b, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Call is Do for functions that return a value
+func Call[T any](ctx context.Context, b *Bulkhead, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	if !b.slots.TryAcquire(1) {
+		if b.waiting.Add(1) > b.queue {
+			b.waiting.Add(-1)
+			return zero, ErrFull
+		}
+		err := b.slots.Acquire(ctx, 1)
+		b.waiting.Add(-1)
+		if err != nil {
+			return zero, err
+		}
+	}
+	defer b.slots.Release(1)
+	b.running.Add(1)
+	defer b.running.Add(-1)
+	return fn(ctx)
+}
+
+// Running returns the number of calls holding a slot
+func (b *Bulkhead) Running() int {
+	return int(b.running.Load())
+}
+
+// Waiting returns the number of calls waiting for a slot
+func (b *Bulkhead) Waiting() int {
+	return int(b.waiting.Load())
+}
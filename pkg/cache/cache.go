@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/shardmap"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/singleflight"
+)
+
+// LOADING CACHE
+// Enrichment stages look up reference data for every value (the customer of an order, the country of an IP),
+// mostly the same few keys again and again. The cache keeps the loaded values for a while (TTL),
+// splits them in shards with their own lock (shardmap) so parallel workers rarely wait for each other, and
+// when many workers miss the same key at the same time only one of them loads it (singleflight).
+
+// DefaultShards is the number of shards when WithShards is not used
+const DefaultShards = 16
+
+// Option configures a cache
+type Option func(*options)
+
+type options struct {
+	shards int
+	clock  clock.Clock
+}
+
+// WithShards sets the number of shards, more shards means less contention between workers
+func WithShards(n int) Option {
+	return func(o *options) {
+		o.shards = max(n, 1)
+	}
+}
+
+// WithClock sets the clock used for the expirations, clock.Real by default
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// Cache is a concurrent cache of values that expire after a TTL
+type Cache[K comparable, V any] struct {
+	ttl   time.Duration
+	clock clock.Clock
+	items *shardmap.Map[K, entry[V]]
+	loads singleflight.Group[K, V]
+}
+
+type entry[V any] struct {
+	v       V
+	expires time.Time // zero if it never expires
+}
+
+// New creates a cache whose values expire ttl after they were stored, they never expire if ttl is zero
+func New[K comparable, V any](ttl time.Duration, opts ...Option) *Cache[K, V] {
+	return NewWithHash[K, V](ttl, nil, opts...)
+}
+
+// NewWithHash is New with the function that picks the shard of a key (see shardmap.NewWithHash),
+// it must return the same value for equal keys, a nil hash uses shardmap.Hash
+func NewWithHash[K comparable, V any](ttl time.Duration, hash func(key K) uint64, opts ...Option) *Cache[K, V] {
+	o := options{shards: DefaultShards, clock: clock.Real}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Cache[K, V]{ttl: max(ttl, 0), clock: o.clock, items: shardmap.NewWithHash[K, entry[V]](o.shards, hash)}
+}
+
+// Get returns the value of the key if it's cached and has not expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	e, ok := c.items.Load(key)
+	if !ok || c.expired(e) {
+		var zero V
+		return zero, false
+	}
+	return e.v, true
+}
+
+// Set stores the value of the key, replacing the one cached
+func (c *Cache[K, V]) Set(key K, v V) {
+	e := entry[V]{v: v}
+	if c.ttl > 0 {
+		e.expires = c.clock.Now().Add(c.ttl)
+	}
+	c.items.Store(key, e)
+}
+
+// Delete removes the key from the cache
+func (c *Cache[K, V]) Delete(key K) {
+	c.items.Delete(key)
+}
+
+// GetOrLoad returns the cached value of the key or loads it, the concurrent misses of the same key
+// share a single call to loader, errors are returned and not cached
+func (c *Cache[K, V]) GetOrLoad(ctx context.Context, key K, loader func(ctx context.Context, key K) (V, error)) (V, error) {
+	if v, ok := c.Get(key); ok {
+		return v, nil
+	}
+	return c.loads.Do(ctx, key, func(ctx context.Context) (V, error) {
+		if v, ok := c.Get(key); ok {
+			return v, nil // loaded by a call that just finished
+		}
+		v, err := loader(ctx, key)
+		if err == nil {
+			c.Set(key, v)
+		}
+		return v, err
+	})
+}
+
+// Len returns the number of entries, the expired ones not removed yet included
+func (c *Cache[K, V]) Len() int {
+	return c.items.Len()
+}
+
+// DeleteExpired removes the expired entries, expired entries are never returned
+// but they take memory until they are removed or replaced, call it every now and then
+func (c *Cache[K, V]) DeleteExpired() {
+	c.items.Range(func(key K, _ entry[V]) bool {
+		c.items.Compute(key, func(e entry[V], ok bool) (entry[V], bool) {
+			return e, ok && !c.expired(e) // checked again, it may have been replaced
+		})
+		return true
+	})
+}
+
+func (c *Cache[K, V]) expired(e entry[V]) bool {
+	return !e.expires.IsZero() && !c.clock.Now().Before(e.expires)
+}
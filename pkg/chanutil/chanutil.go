@@ -0,0 +1,127 @@
+package chanutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// CHANNEL UTILITIES
+// Small generic helpers for the things done over and over with channels,
+// every one of them listens to the context so none can block forever.
+
+// ErrClosed is returned when the channels are closed before a value could be received
+var ErrClosed = errors.New("chanutil: channel closed")
+
+// First returns the first value received from any of the channels, only that value is consumed
+func First[T any](ctx context.Context, chans ...<-chan T) (T, error) {
+	var zero T
+	// Select receives from exactly one channel, goroutines per channel would consume extra values
+	open := make([]<-chan T, len(chans))
+	copy(open, chans)
+	for left := len(open); left > 0; left-- {
+		i, v, ok, err := Select(ctx, open)
+		if err != nil {
+			return zero, err
+		}
+		if ok {
+			return v, nil
+		}
+		open[i] = nil // a nil channel is never ready
+	}
+	return zero, ErrClosed
+}
+
+// All receives one value from every channel and returns them in the order of the channels
+func All[T any](ctx context.Context, chans ...<-chan T) ([]T, error) {
+	res := make([]T, len(chans))
+	for i, ch := range chans {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return nil, ErrClosed
+			}
+			res[i] = v
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return res, nil
+}
+
+// Any returns a channel that is closed as soon as any of the done channels is closed (the or-channel pattern),
+// it keeps a goroutine per channel until that happens
+func Any(dones ...<-chan struct{}) <-chan struct{} {
+	out := make(chan struct{})
+	if len(dones) == 0 {
+		return out // never closed
+	}
+	var once sync.Once
+	for _, done := range dones {
+		go func() {
+			select {
+			case <-done:
+				once.Do(func() { close(out) })
+			case <-out: // another one was first
+			}
+		}()
+	}
+	return out
+}
+
+// Pair holds a value of each of the zipped channels
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+// Zip pairs up the values of both channels in order, it stops when either of them is closed
+func Zip[A, B any](ctx context.Context, a <-chan A, b <-chan B) <-chan Pair[A, B] {
+	out := make(chan Pair[A, B])
+	go func() {
+		defer close(out)
+		for {
+			var p Pair[A, B]
+			var ok bool
+			select {
+			case p.First, ok = <-a:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case p.Second, ok = <-b:
+				if !ok {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Drain reads and discards every value until the channel is closed or the context is done,
+// it returns the number of values discarded
+func Drain[T any](ctx context.Context, in <-chan T) int {
+	var n int
+	for {
+		select {
+		case _, ok := <-in:
+			if !ok {
+				return n
+			}
+			n++
+		case <-ctx.Done():
+			return n
+		}
+	}
+}
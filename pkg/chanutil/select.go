@@ -0,0 +1,114 @@
+package chanutil
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// DYNAMIC SELECT
+// A select statement lists its channels in the source code, so it can't wait on a slice of channels
+// whose length is only known at runtime. reflect.Select can: it builds the cases from a slice.
+// It costs more than a plain select (and grows with the number of channels), so past a certain
+// number of channels a goroutine per channel forwarding to a single one is cheaper.
+
+// MaxReflectSelect is the number of channels up to which Multiplex uses reflect.Select
+const MaxReflectSelect = 64
+
+// Select waits on every channel at once and receives from exactly one of them, like a select statement,
+// it returns the index of the channel, the value and false if the channel was closed
+func Select[T any](ctx context.Context, chans []<-chan T) (int, T, bool, error) {
+	var zero T
+	cases := selectCases(ctx, chans)
+	i, v, ok := reflect.Select(cases)
+	if i == 0 {
+		return -1, zero, false, ctx.Err()
+	}
+	if !ok {
+		return i - 1, zero, false, nil
+	}
+	x, _ := v.Interface().(T) // a nil interface value keeps the zero value
+	return i - 1, x, true, nil
+}
+
+// selectCases builds the receive cases, the first one is the context
+func selectCases[T any](ctx context.Context, chans []<-chan T) []reflect.SelectCase {
+	cases := make([]reflect.SelectCase, 0, len(chans)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	for _, ch := range chans {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	return cases
+}
+
+// Received is a value together with the index of the channel it came from
+type Received[T any] struct {
+	Index int
+	Value T
+}
+
+// Multiplex forwards the values of every channel to a single channel, tagged with the index of their channel,
+// the returned channel is closed when every channel is closed or the context is done
+func Multiplex[T any](ctx context.Context, chans ...<-chan T) <-chan Received[T] {
+	if len(chans) > MaxReflectSelect {
+		return multiplexGoroutines(ctx, chans)
+	}
+
+	out := make(chan Received[T])
+	go func() {
+		defer close(out)
+		cases := selectCases(ctx, chans)
+		for open := len(chans); open > 0; {
+			i, v, ok := reflect.Select(cases)
+			if i == 0 {
+				return
+			}
+			if !ok {
+				cases[i].Chan = reflect.Value{} // a zero channel is ignored by select
+				open--
+				continue
+			}
+			x, _ := v.Interface().(T) // a nil interface value keeps the zero value
+			select {
+			case out <- Received[T]{Index: i - 1, Value: x}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// multiplexGoroutines is the fallback of Multiplex for many channels
+func multiplexGoroutines[T any](ctx context.Context, chans []<-chan T) <-chan Received[T] {
+	out := make(chan Received[T])
+	var wg sync.WaitGroup
+	wg.Add(len(chans))
+	for i, ch := range chans {
+		go func() {
+			defer wg.Done()
+			for {
+				var v T
+				select {
+				case x, ok := <-ch:
+					if !ok {
+						return
+					}
+					v = x
+				case <-ctx.Done():
+					return // the channel may never be closed
+				}
+				select {
+				case out <- Received[T]{Index: i, Value: v}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
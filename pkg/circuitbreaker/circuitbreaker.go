@@ -0,0 +1,212 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+)
+
+// CIRCUIT BREAKER
+// When a dependency is down every call waits for a timeout before failing, the workers pile up
+// and the dependency gets even more load while it's trying to recover.
+// A breaker counts the failures: when too many recent calls failed it opens and calls fail fast
+// without reaching the dependency. After a cool-down it lets a few trial calls through (half-open),
+// if they succeed it closes again, if any of them fails it opens for another cool-down.
+
+// ErrOpen is returned instead of calling the function while the breaker is open
+var ErrOpen = errors.New("circuitbreaker: circuit open")
+
+// errPanicked is the result recorded for a call that panicked
+var errPanicked = errors.New("circuitbreaker: panic")
+
+// State is the state of a breaker
+type State int
+
+const (
+	// Closed lets every call through and counts the failures
+	Closed State = iota
+	// Open fails every call with ErrOpen until the cool-down is over
+	Open
+	// HalfOpen lets a few trial calls through to decide whether to close or open again
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Config configures a breaker, the zero value is usable
+type Config struct {
+	FailureRate      float64              // rate of failed calls in the window that opens the breaker, 0.5 if not set
+	MinRequests      int                  // calls in the window before the rate is checked, 10 if not set
+	Window           int                  // number of recent calls considered, 2 * MinRequests if not set
+	CoolDown         time.Duration        // time spent open before trying again, 5s if not set
+	HalfOpenRequests int                  // trial calls that must succeed to close the breaker, 1 if not set
+	IsFailure        func(err error) bool // nil means every error except a context error is a failure
+	OnStateChange    func(from, to State) // called with the breaker locked, it must not use the breaker
+	Clock            clock.Clock          // clock.Real if not set
+}
+
+// Breaker is a circuit breaker, it's safe for concurrent use
+type Breaker struct {
+	cfg Config
+
+	mu         sync.Mutex
+	state      State
+	generation uint64    // incremented on every state change, results of older calls are ignored
+	openedAt   time.Time // when the breaker opened
+	results    []bool    // ring buffer of the last calls in the closed state, true is a failure
+	next       int
+	count      int
+	failures   int
+	trials     int // calls let through in the half-open state
+	successes  int // trial calls that succeeded
+}
+
+// New creates a closed breaker
+func New(cfg Config) *Breaker {
+	if cfg.FailureRate <= 0 {
+		cfg.FailureRate = 0.5
+	}
+	if cfg.MinRequests < 1 {
+		cfg.MinRequests = 10
+	}
+	if cfg.Window < cfg.MinRequests {
+		cfg.Window = 2 * cfg.MinRequests
+	}
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 5 * time.Second
+	}
+	if cfg.HalfOpenRequests < 1 {
+		cfg.HalfOpenRequests = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real
+	}
+	return &Breaker{cfg: cfg, results: make([]bool, cfg.Window)}
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.coolDown()
+	return b.state
+}
+
+// Do calls fn if the breaker allows it and records the result, otherwise it returns ErrOpen
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := Call(ctx, b, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Call runs fn through the breaker like Do and returns its value, a panic in fn is recorded as a failure
+func Call[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error)) (res T, err error) {
+	gen, err := b.allow()
+	if err != nil {
+		return res, err
+	}
+	err = errPanicked // still set if fn panics
+	defer func() { b.record(gen, err) }()
+	return fn(ctx)
+}
+
+// allow checks whether a call can go through and returns the generation it belongs to
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.coolDown()
+	switch b.state {
+	case Open:
+		return 0, ErrOpen
+	case HalfOpen:
+		if b.trials >= b.cfg.HalfOpenRequests {
+			return 0, ErrOpen // enough trial calls already in flight
+		}
+		b.trials++
+	}
+	return b.generation, nil
+}
+
+// record counts the result of a call
+func (b *Breaker) record(gen uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		return // the call started before the last state change
+	}
+	failed := errors.Is(err, errPanicked) || (err != nil && b.cfg.IsFailure(err))
+	cancelled := !failed && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+
+	switch b.state {
+	case Closed:
+		if b.count == len(b.results) {
+			if b.results[b.next] {
+				b.failures--
+			}
+		} else {
+			b.count++
+		}
+		b.results[b.next] = failed
+		b.next = (b.next + 1) % len(b.results)
+		if failed {
+			b.failures++
+		}
+		if b.count >= b.cfg.MinRequests && float64(b.failures)/float64(b.count) >= b.cfg.FailureRate {
+			b.setState(Open)
+		}
+	case HalfOpen:
+		if failed {
+			b.setState(Open)
+			return
+		}
+		if cancelled {
+			b.trials-- // the trial says nothing about the dependency, let another call try
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenRequests {
+			b.setState(Closed)
+		}
+	}
+}
+
+// coolDown moves an open breaker to half-open once the cool-down is over
+func (b *Breaker) coolDown() {
+	if b.state == Open && !b.cfg.Clock.Now().Before(b.openedAt.Add(b.cfg.CoolDown)) {
+		b.setState(HalfOpen)
+	}
+}
+
+// setState moves to a new state and resets what was counted in the previous one
+func (b *Breaker) setState(s State) {
+	from := b.state
+	b.state = s
+	b.generation++
+	b.trials, b.successes = 0, 0
+	b.next, b.count, b.failures = 0, 0, 0
+	if s == Open {
+		b.openedAt = b.cfg.Clock.Now()
+	}
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, s)
+	}
+}
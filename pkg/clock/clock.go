@@ -0,0 +1,200 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// CLOCK
+// Stages that depend on time (batch, throttle, debounce, windows) are hard to test with the real clock:
+// tests need sleeps, they are slow and they fail on a busy machine.
+// Stages ask an injected clock for the time instead, in production it's the real one,
+// in tests it's a manual clock that only moves when the test says so.
+
+// Clock is the subset of the time package used by the stages
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the interface of a *time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the interface of a *time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the clock of the time package
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// Manual is a clock that only moves when Advance or Set are called, it's safe for concurrent use
+type Manual struct {
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled when a timer or ticker is created
+	now     time.Time
+	waiters map[*manualTimer]struct{}
+}
+
+// NewManual creates a manual clock set at the given time
+func NewManual(now time.Time) *Manual {
+	m := &Manual{now: now, waiters: make(map[*manualTimer]struct{})}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// Now implements Clock
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// After implements Clock
+func (m *Manual) After(d time.Duration) <-chan time.Time {
+	return m.NewTimer(d).C()
+}
+
+// NewTimer implements Clock
+func (m *Manual) NewTimer(d time.Duration) Timer {
+	return m.add(d, 0)
+}
+
+// NewTicker implements Clock
+func (m *Manual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return manualTicker{m.add(d, d)}
+}
+
+// Advance moves the clock forward and fires the timers and tickers that are due
+func (m *Manual) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+	m.fire()
+}
+
+// Set moves the clock to the given time, it can't go backwards
+func (m *Manual) Set(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.After(m.now) {
+		m.now = t
+	}
+	m.fire()
+}
+
+// Waiters returns the number of active timers and tickers
+func (m *Manual) Waiters() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.waiters)
+}
+
+// BlockUntil waits until there are at least n active timers and tickers,
+// so a test knows the stage is waiting before moving the clock
+func (m *Manual) BlockUntil(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.waiters) < n {
+		m.cond.Wait()
+	}
+}
+
+func (m *Manual) add(d, period time.Duration) *manualTimer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := &manualTimer{clock: m, c: make(chan time.Time, 1), at: m.now.Add(d), period: period}
+	m.waiters[t] = struct{}{}
+	m.cond.Broadcast()
+	m.fire()
+	return t
+}
+
+// fire sends the current time on every waiter that is due, like the time package it never blocks
+func (m *Manual) fire() {
+	for t := range m.waiters {
+		if t.at.After(m.now) {
+			continue
+		}
+		select {
+		case t.c <- m.now:
+		default: // the previous tick was not read yet, this one is lost
+		}
+		if t.period == 0 {
+			delete(m.waiters, t)
+			continue
+		}
+		for !t.at.After(m.now) {
+			t.at = t.at.Add(t.period)
+		}
+	}
+}
+
+type manualTimer struct {
+	clock  *Manual
+	c      chan time.Time
+	at     time.Time
+	period time.Duration // zero for timers
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	_, active := t.clock.waiters[t]
+	delete(t.clock.waiters, t)
+	return active
+}
+
+func (t *manualTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	_, active := t.clock.waiters[t]
+	t.at = t.clock.now.Add(d)
+	if t.period != 0 {
+		t.period = d
+	}
+	t.clock.waiters[t] = struct{}{}
+	t.clock.cond.Broadcast()
+	t.clock.fire()
+	return active
+}
+
+type manualTicker struct {
+	*manualTimer
+}
+
+func (t manualTicker) Stop() {
+	t.manualTimer.Stop()
+}
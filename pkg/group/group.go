@@ -0,0 +1,116 @@
+package group
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// GROUP
+// Same idea as golang.org/x/sync/errgroup: run a set of goroutines, wait for all of them
+// and keep the first error, cancelling the shared context so the others can exit early.
+// On top of that a panic in a goroutine becomes an error instead of crashing the process.
+
+// PanicError is the error returned by Wait when a goroutine panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("group: panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Group is a collection of goroutines working on subtasks of the same task,
+// the zero value is valid, has no limit and does not cancel on error
+type Group struct {
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	sem    chan struct{} // one slot per running goroutine when there is a limit
+
+	once sync.Once
+	err  error
+}
+
+// WithContext returns a new group and a derived context that is cancelled
+// the first time a goroutine returns an error (the cause of the cancellation) or Wait returns
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+// SetLimit bounds the number of goroutines running at the same time, a negative value removes the limit,
+// it must not be called while goroutines are running
+func (g *Group) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("group: modify limit while %v goroutines are still running", len(g.sem)))
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Go runs fn in a new goroutine, it blocks while the group is at its limit
+func (g *Group) Go(fn func() error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.start(fn)
+}
+
+// TryGo runs fn in a new goroutine only if the group is below its limit, it reports whether it did
+func (g *Group) TryGo(fn func() error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	g.start(fn)
+	return true
+}
+
+// Wait blocks until every goroutine has returned and then returns the first error (if any)
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel(g.err)
+	}
+	return g.err
+}
+
+func (g *Group) start(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+		if err := g.call(fn); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel(err)
+				}
+			})
+		}
+	}()
+}
+
+// call runs fn turning a panic into a PanicError
+func (g *Group) call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
@@ -0,0 +1,165 @@
+package mpsc
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+)
+
+// LOCK-FREE QUEUE
+// A channel is a queue protected by a lock: every send and every receive takes it.
+// When many goroutines send to a single receiver (the workers of a stage feeding the next one)
+// a ring buffer where every slot has a sequence number does the same without a lock:
+// producers claim a slot with a compare-and-swap on the tail, the only consumer reads the head without any.
+// It's bounded like a buffered channel, a producer waits when it's full and the consumer when it's empty.
+// Waiting uses channels, but only when the queue is full or empty, not on every value.
+
+// spins is how many times Push and Pop retry before blocking
+const spins = 16
+
+// Queue is a bounded multi-producer single-consumer queue, Pop must only be called by one goroutine at a time
+type Queue[T any] struct {
+	slots []slot[T]
+	mask  uint64
+
+	tail atomic.Uint64 // next position to write, shared by the producers
+	_    [56]byte      // keeps tail and head in different cache lines
+	head uint64        // next position to read, only touched by the consumer
+
+	length atomic.Int64
+	closed atomic.Bool
+
+	notEmpty chan struct{} // wakes the consumer
+	notFull  chan struct{} // wakes a producer
+}
+
+type slot[T any] struct {
+	seq   atomic.Uint64 // pos when the slot is free for position pos, pos+1 when it holds the value of pos
+	value T
+}
+
+// New creates a queue for at least capacity values, the capacity is rounded up to a power of two
+func New[T any](capacity int) *Queue[T] {
+	n := 2
+	for n < capacity {
+		n <<= 1
+	}
+	q := &Queue[T]{
+		slots:    make([]slot[T], n),
+		mask:     uint64(n - 1),
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+	}
+	for i := range q.slots {
+		q.slots[i].seq.Store(uint64(i))
+	}
+	return q
+}
+
+// Cap returns the capacity of the queue
+func (q *Queue[T]) Cap() int {
+	return len(q.slots)
+}
+
+// Len returns the number of values in the queue
+func (q *Queue[T]) Len() int {
+	return int(q.length.Load())
+}
+
+// TryPush adds the value if the queue is not full
+func (q *Queue[T]) TryPush(v T) bool {
+	for {
+		pos := q.tail.Load()
+		s := &q.slots[pos&q.mask]
+		switch seq := s.seq.Load(); {
+		case seq == pos:
+			if !q.tail.CompareAndSwap(pos, pos+1) {
+				continue // another producer claimed it
+			}
+			s.value = v
+			s.seq.Store(pos + 1) // PUBLISH the value to the consumer
+			q.length.Add(1)
+			signal(q.notEmpty)
+			return true
+		case seq < pos:
+			return false // the consumer didn't free the slot yet: full
+		}
+		// another producer moved the tail since we read it, try again
+	}
+}
+
+// Push adds the value, waiting while the queue is full, it returns false if the context is done first
+func (q *Queue[T]) Push(ctx context.Context, v T) bool {
+	for i := 0; ; i++ {
+		if q.TryPush(v) {
+			if q.Len() < len(q.slots) {
+				signal(q.notFull) // pass the wake up on to another waiting producer
+			}
+			return true
+		}
+		if i < spins {
+			runtime.Gosched()
+			continue
+		}
+		select {
+		case <-q.notFull:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// TryPop removes the oldest value if there is one, only the consumer can call it
+func (q *Queue[T]) TryPop() (T, bool) {
+	var zero T
+	s := &q.slots[q.head&q.mask]
+	if s.seq.Load() != q.head+1 {
+		return zero, false // empty, or a producer claimed the slot but didn't write it yet
+	}
+	v := s.value
+	s.value = zero
+	s.seq.Store(q.head + q.mask + 1) // FREE the slot for the position one lap later
+	q.head++
+	q.length.Add(-1)
+	signal(q.notFull)
+	return v, true
+}
+
+// Pop removes the oldest value, waiting while the queue is empty, only the consumer can call it,
+// it returns false once the queue is closed and empty or if the context is done first
+func (q *Queue[T]) Pop(ctx context.Context) (T, bool) {
+	for i := 0; ; i++ {
+		if v, ok := q.TryPop(); ok {
+			return v, true
+		}
+		if q.closed.Load() {
+			// values pushed before Close are still in the queue
+			return q.TryPop()
+		}
+		if i < spins {
+			runtime.Gosched()
+			continue
+		}
+		select {
+		case <-q.notEmpty:
+		case <-ctx.Done():
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+// Close tells the consumer no more values will be pushed, like closing a channel it must be called
+// once every producer is done
+func (q *Queue[T]) Close() {
+	q.closed.Store(true)
+	signal(q.notEmpty)
+}
+
+// signal wakes up a waiter without blocking, a pending signal is enough
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
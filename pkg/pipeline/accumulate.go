@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ACCUMULATING SINK
+// Batch works between stages, but the sink still receives one value at a time. An Accumulator is a sink
+// that keeps the values and hands them to a flush function every size values or every interval,
+// whatever happens first. Teardown is where the values get lost: the last partial batch must be flushed
+// on Close, with a context that is not the one that just got cancelled, and a failed flush keeps its values
+// so the next one (or Close) tries them again.
+// e.g. err := p.Sink(acc.Add).Run(ctx); err = errors.Join(err, acc.Close(context.WithoutCancel(ctx)))
+
+// ErrAccumulatorClosed is returned by Add after Close
+var ErrAccumulatorClosed = errors.New("pipeline: accumulator closed")
+
+// Accumulator is a sink that flushes the values it receives in groups
+type Accumulator[T any] struct {
+	size  int
+	flush func(ctx context.Context, items []T) error
+
+	mu     sync.Mutex
+	items  []T
+	err    error // of the last periodic flush, returned by the next Add
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewAccumulator returns an accumulator that calls flush every size values (zero means no limit)
+// and every interval while ctx is not done (zero means never), flush owns the slice if it succeeds
+// and flushes never overlap, it accepts WithClock
+func NewAccumulator[T any](ctx context.Context, size int, interval time.Duration, flush func(ctx context.Context, items []T) error, opts ...Option) *Accumulator[T] {
+	o := newStageOptions(opts)
+	a := &Accumulator[T]{
+		size:  max(size, 0),
+		flush: flush,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(a.done)
+		return a
+	}
+	go func() {
+		defer close(a.done)
+		ticker := o.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				a.mu.Lock()
+				if err := a.flushLocked(ctx); err != nil {
+					a.err = err
+				}
+				a.mu.Unlock()
+			case <-a.stop:
+				return
+			case <-ctx.Done():
+				return // what is left is flushed by Close
+			}
+		}
+	}()
+	return a
+}
+
+// Add keeps v and flushes if there are size values, it's a SinkFunc,
+// it returns the error of a failed flush (the values are kept for the next one)
+func (a *Accumulator[T]) Add(ctx context.Context, v T) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return ErrAccumulatorClosed
+	}
+	a.items = append(a.items, v)
+	if err := a.err; err != nil {
+		a.err = nil
+		return err
+	}
+	if a.size > 0 && len(a.items) >= a.size {
+		return a.flushLocked(ctx)
+	}
+	return nil
+}
+
+// Flush flushes the values kept so far
+func (a *Accumulator[T]) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked(ctx)
+}
+
+// Close stops the periodic flushes and flushes the values that are left, ctx should not be the context
+// of the pipeline if it can be cancelled (the last values would be lost), Add fails after Close
+func (a *Accumulator[T]) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	a.mu.Unlock()
+
+	close(a.stop)
+	<-a.done // a periodic flush in progress ends before the last one
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked(ctx)
+}
+
+// flushLocked calls flush with the values kept, they are only dropped if it succeeds
+func (a *Accumulator[T]) flushLocked(ctx context.Context) error {
+	if len(a.items) == 0 {
+		return nil
+	}
+	if err := a.flush(ctx, a.items); err != nil {
+		return fmt.Errorf("pipeline: flush: %w", err)
+	}
+	a.items = nil
+	return nil
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// AT-LEAST-ONCE DELIVERY
+// Once a value leaves the source nobody knows if it was really processed: a crash or a bug downstream loses it.
+// With acknowledgements the sink tells the source when it's done with a value (Ack) or when it failed (Nack).
+// Values that are nacked, or not acked in time, are sent again, so every value is processed at least once
+// (sometimes more than once: sinks should be idempotent).
+
+// Message is a value that must be acknowledged
+type Message[T any] struct {
+	Value   T
+	Attempt int // 1 on the first delivery
+
+	id   uint64
+	acks chan<- ackEvent
+	done <-chan struct{}
+}
+
+type ackEvent struct {
+	id uint64
+	ok bool
+}
+
+// Ack marks the value as processed, it won't be sent again
+func (m *Message[T]) Ack() {
+	m.settle(true)
+}
+
+// Nack marks the value as failed, it's sent again right away
+func (m *Message[T]) Nack() {
+	m.settle(false)
+}
+
+func (m *Message[T]) settle(ok bool) {
+	select {
+	case m.acks <- ackEvent{id: m.id, ok: ok}:
+	case <-m.done: // delivery is over, nothing to acknowledge
+	}
+}
+
+// AckConfig configures AtLeastOnce
+type AckConfig struct {
+	Timeout     time.Duration // a value not acked after this long is sent again, 30s if not set
+	MaxInFlight int           // values sent and not acked yet, the input is not read while at the limit, 0 means no limit
+}
+
+// AtLeastOnce sends every value received from in as a message that must be acknowledged,
+// the returned channel is closed once the input is closed and every message has been acked
+func AtLeastOnce[T any](ctx context.Context, in <-chan T, cfg AckConfig) <-chan *Message[T] {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	out := make(chan *Message[T])
+	acks := make(chan ackEvent)
+	done := make(chan struct{})
+
+	type entry struct {
+		value    T
+		attempt  int
+		deadline time.Time // zero while waiting in the queue
+	}
+
+	go func() {
+		defer close(out)
+		defer close(done)
+
+		var nextID uint64
+		var next *Message[T]               // the message waiting to be sent
+		pending := make(map[uint64]*entry) // every value not acked yet
+		var queue []uint64                 // ids waiting to be sent, new or redelivered
+
+		ticker := time.NewTicker(max(cfg.Timeout/4, time.Millisecond))
+		defer ticker.Stop()
+
+		for in != nil || len(pending) > 0 {
+			// SOURCE GATING: stop reading while too many values are in flight
+			src := in
+			if cfg.MaxInFlight > 0 && len(pending) >= cfg.MaxInFlight {
+				src = nil
+			}
+
+			// only try to send when there is something queued
+			var sendCh chan *Message[T]
+			for len(queue) > 0 && pending[queue[0]] == nil {
+				queue = queue[1:] // acked while waiting to be sent again
+			}
+			if len(queue) > 0 {
+				// the message is only allocated again when the head of the queue changes
+				if id := queue[0]; next == nil || next.id != id {
+					e := pending[id]
+					next = &Message[T]{Value: e.value, Attempt: e.attempt + 1, id: id, acks: acks, done: done}
+				}
+				sendCh = out
+			}
+
+			select {
+			case v, ok := <-src:
+				if !ok {
+					in = nil
+					continue
+				}
+				pending[nextID] = &entry{value: v}
+				queue = append(queue, nextID)
+				nextID++
+			case sendCh <- next:
+				queue = queue[1:]
+				e := pending[next.id]
+				e.attempt = next.Attempt
+				e.deadline = time.Now().Add(cfg.Timeout)
+				next = nil // it belongs to the consumer now
+			case a := <-acks:
+				e, ok := pending[a.id]
+				switch {
+				case !ok:
+					// already acked
+				case a.ok:
+					delete(pending, a.id)
+				case !e.deadline.IsZero():
+					e.deadline = time.Time{}
+					queue = append(queue, a.id)
+				}
+			case now := <-ticker.C:
+				// REDELIVERY of the values whose deadline has passed
+				for id, e := range pending {
+					if !e.deadline.IsZero() && now.After(e.deadline) {
+						e.deadline = time.Time{}
+						queue = append(queue, id)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,123 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AUTO-SCALING
+// FanOut needs the number of workers up front, but the load of a real pipeline changes over time.
+// The values wait in a queue in front of the workers: a queue that keeps filling up means the workers
+// can't keep up (add one), an empty queue means some of them are idle (remove one).
+
+// ScaleConfig configures AutoScale
+type ScaleConfig struct {
+	Min       int               // workers always running, at least one
+	Max       int               // upper bound of workers
+	Interval  time.Duration     // how often the queue is checked, 100ms if not set
+	QueueSize int               // capacity of the queue in front of the workers, Max if not set
+	OnScale   func(workers int) // optional, called every time the number of workers changes
+}
+
+// AutoScale applies fn to every value received from in using between Min and Max workers,
+// the number of workers follows the depth of the queue, the order of the values is not preserved
+func AutoScale[In, Out any](ctx context.Context, in <-chan In, fn func(context.Context, In) Out, cfg ScaleConfig) <-chan Out {
+	cfg.Min = max(cfg.Min, 1)
+	cfg.Max = max(cfg.Max, cfg.Min)
+	if cfg.Interval <= 0 {
+		cfg.Interval = 100 * time.Millisecond
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = cfg.Max
+	}
+
+	queue := make(chan In, cfg.QueueSize)
+	fed := make(chan struct{}) // closed once the input has been consumed
+	out := make(chan Out)
+
+	// the feeder moves the values into the queue so its depth can be measured
+	go func() {
+		defer close(fed)
+		defer close(queue)
+		for v := range in {
+			select {
+			case queue <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	worker := func(wg *sync.WaitGroup, stop <-chan struct{}) {
+		defer wg.Done()
+		for {
+			select {
+			case v, ok := <-queue:
+				if !ok {
+					return
+				}
+				select {
+				case out <- fn(ctx, v):
+				case <-ctx.Done():
+					return
+				}
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	go func() {
+		var wg sync.WaitGroup
+		var stops []chan struct{} // one per running worker
+		grow := func() {
+			stop := make(chan struct{})
+			stops = append(stops, stop)
+			wg.Add(1)
+			go worker(&wg, stop)
+		}
+		shrink := func() {
+			last := len(stops) - 1
+			close(stops[last])
+			stops = stops[:last]
+		}
+		notify := func() {
+			if cfg.OnScale != nil {
+				cfg.OnScale(len(stops))
+			}
+		}
+
+		for len(stops) < cfg.Min {
+			grow()
+		}
+		notify()
+
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		high := max(cfg.QueueSize/2, 1)
+	loop:
+		for {
+			select {
+			case <-ticker.C:
+				switch depth := len(queue); {
+				case depth >= high && len(stops) < cfg.Max:
+					grow()
+					notify()
+				case depth == 0 && len(stops) > cfg.Min:
+					shrink()
+					notify()
+				}
+			case <-fed:
+				break loop // the running workers drain the queue
+			case <-ctx.Done():
+				break loop
+			}
+		}
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,47 @@
+package pipeline
+
+import "context"
+
+// BACKPRESSURE
+// A full channel blocks the sender, and that pushes back on every stage upstream up to the source.
+// That's what we want most of the time, but a source fed by the real world (sensors, events, market data)
+// can't be paused: it's better to shed load on purpose. DropNewest keeps the values already waiting
+// and discards the new one, DropOldest keeps the freshest data (ring buffer semantics).
+
+// offer sends v to out following the overflow policy, sent is false only when the context is done
+// and dropped reports whether a value (the new one or an old one) was discarded
+func offer[T any](ctx context.Context, out chan T, v T, policy Overflow) (sent, dropped bool) {
+	if policy == DropOldest && cap(out) == 0 {
+		policy = DropNewest // nothing waits in an unbuffered channel, there is no oldest value
+	}
+
+	switch policy {
+	case DropNewest:
+		select {
+		case out <- v:
+			return true, false
+		default:
+			return true, true
+		}
+	case DropOldest:
+		for {
+			select {
+			case out <- v:
+				return true, dropped
+			default:
+			}
+			select {
+			case <-out: // evict the oldest value
+				dropped = true
+			default: // the consumer took one in the meantime
+			}
+		}
+	default:
+		select {
+		case out <- v:
+			return true, false
+		case <-ctx.Done():
+			return false, false
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+)
+
+// BATCHING
+// Databases and APIs usually prefer a few big writes over many small ones.
+// Batch groups values into slices, a batch is sent when it's full
+// or when maxWait has passed since its first value arrived (whatever happens first).
+
+// Batch groups the values received from in into slices of up to size elements,
+// a zero maxWait means batches are only sent when full (or when the input is closed), it accepts WithClock
+func Batch[T any](ctx context.Context, in <-chan T, size int, maxWait time.Duration, opts ...Option) <-chan []T {
+	o := newStageOptions(opts)
+	if size < 1 {
+		size = 1
+	}
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		var batch []T
+		var timer clock.Timer
+		var timeout <-chan time.Time // nil until the batch has its first value
+
+		flush := func() bool {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+			if len(batch) == 0 {
+				return true
+			}
+			select {
+			case out <- batch:
+				batch = nil
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					flush() // send what is left
+					return
+				}
+				batch = append(batch, v)
+				if len(batch) == 1 && maxWait > 0 {
+					timer = o.clock.NewTimer(maxWait)
+					timeout = timer.C()
+				}
+				if len(batch) >= size && !flush() {
+					return
+				}
+			case <-timeout:
+				if !flush() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,132 @@
+package pipeline_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+)
+
+// BENCHMARKS
+// How big should the buffers be? How many workers? Is batching worth it? It depends on the machine
+// and on how much work every value takes, so the answer has to be measured:
+// go test -bench Pipeline -benchmem ./pkg/pipeline
+// Every configuration runs the standard pipeline (generate -> power -> sum) over the same values.
+
+// benchItems is the number of values going through the pipeline in every iteration
+const benchItems = 10000
+
+// benchConfig is a variant of the standard pipeline
+type benchConfig struct {
+	name    string
+	buffer  int // capacity of the channel of every stage, zero means unbuffered
+	workers int // goroutines running the power stage
+	batch   int // values sent together in a slice, zero or one means one by one
+	work    int // iterations of busy work per value, to simulate a stage that does something
+
+	lockFree bool // the power stage sends through an mpsc queue instead of a channel
+}
+
+// benchSuite returns the configurations compared: unbuffered against buffered channels,
+// per item against batches, different numbers of workers and channels against the lock-free queue
+func benchSuite(work int) []benchConfig {
+	cfgs := []benchConfig{{name: "unbuffered"}}
+	for _, b := range []int{1, 8, 32, 128, 1024} {
+		cfgs = append(cfgs, benchConfig{name: fmt.Sprintf("buffer %d", b), buffer: b})
+	}
+	for _, b := range []int{16, 64, 256} {
+		cfgs = append(cfgs, benchConfig{name: fmt.Sprintf("batch %d", b), batch: b})
+	}
+	for _, w := range []int{2, 4, runtime.NumCPU()} {
+		cfgs = append(cfgs, benchConfig{name: fmt.Sprintf("workers %d", w), workers: w, buffer: 32})
+	}
+	for _, w := range []int{1, 4} {
+		cfgs = append(cfgs, benchConfig{name: fmt.Sprintf("lock-free workers %d", w), workers: w, buffer: 32, lockFree: true})
+	}
+	for i := range cfgs {
+		cfgs[i].work = work
+	}
+	return cfgs
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	benchmarkPipeline(b, 0)
+}
+
+// BenchmarkPipelineWork is BenchmarkPipeline with a stage that does some work for every value
+func BenchmarkPipelineWork(b *testing.B) {
+	benchmarkPipeline(b, 100)
+}
+
+func benchmarkPipeline(b *testing.B, work int) {
+	values := make([]int, benchItems)
+	for i := range values {
+		values[i] = i
+	}
+	for _, cfg := range benchSuite(work) {
+		b.Run(cfg.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				if cfg.batch > 1 {
+					runBatched(cfg, values)
+				} else {
+					runBuilder(cfg, values)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(values)), "ns/item")
+		})
+	}
+}
+
+// runBuilder runs the standard pipeline with the builder
+func runBuilder(cfg benchConfig, values []int) int {
+	opts := []pipeline.Option{pipeline.WithBuffer(cfg.buffer), pipeline.WithConcurrency(max(cfg.workers, 1))}
+	if cfg.lockFree {
+		opts = append(opts, pipeline.WithLockFree())
+	}
+	var total int
+	_ = pipeline.New[int]().
+		Source(values...).
+		Stage(func(_ context.Context, n int) (int, error) {
+			return power(n, cfg.work), nil
+		}, opts...).
+		Sink(func(_ context.Context, n int) error {
+			total += n
+			return nil
+		}).
+		Run(context.Background())
+	return total
+}
+
+// runBatched runs the standard pipeline sending slices of values between the stages
+func runBatched(cfg benchConfig, values []int) int {
+	ctx := context.Background()
+	batches := pipeline.Batch(ctx, pipeline.Generate(ctx, values...), cfg.batch, 0)
+	powers := pipeline.Map(ctx, batches, func(batch []int) []int {
+		for i, n := range batch {
+			batch[i] = power(n, cfg.work)
+		}
+		return batch
+	})
+	var total int
+	for batch := range powers {
+		for _, n := range batch {
+			total += n
+		}
+	}
+	return total
+}
+
+// power is the work of the power stage, with work iterations of extra computation
+func power(n, work int) int {
+	x := n
+	for i := range work {
+		x ^= x<<1 + i
+	}
+	if x == -1 {
+		return 0 // never true, but the compiler can't drop the loop
+	}
+	return n * n
+}
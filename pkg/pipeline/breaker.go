@@ -0,0 +1,39 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/circuitbreaker"
+)
+
+// SHEDDING
+// Retry keeps calling a dependency that is failing, a breaker stops calling it for a while.
+// Guard calls fn through a breaker: while it's open the values go straight to the dead-letter channel
+// and the stage keeps up with its input instead of waiting for timeouts.
+
+// Guard applies fn to every value received from in through the breaker,
+// successes are sent to the first channel and failures (including circuitbreaker.ErrOpen) to the second one,
+// both channels must be read
+func Guard[In, Out any](ctx context.Context, in <-chan In, b *circuitbreaker.Breaker, fn func(context.Context, In) (Out, error)) (<-chan Out, <-chan Failed[In]) {
+	out := make(chan Out)
+	dead := make(chan Failed[In])
+	go func() {
+		defer close(out)
+		defer close(dead)
+		for v := range in {
+			res, err := circuitbreaker.Call(ctx, b, func(ctx context.Context) (Out, error) {
+				return fn(ctx, v)
+			})
+			if err != nil {
+				if !send(ctx, dead, Failed[In]{Value: v, Err: err, Attempts: 1}) {
+					return
+				}
+				continue
+			}
+			if !send(ctx, out, res) {
+				return
+			}
+		}
+	}()
+	return out, dead
+}
@@ -0,0 +1,36 @@
+package pipeline
+
+import "context"
+
+// BRIDGE
+// Some sources produce streams of streams (a channel per file, per page, per connection...).
+// Bridge flattens them: it consumes the inner channels one after the other, in the order they arrive,
+// so the consumer sees a single channel.
+
+// Bridge forwards the values of every channel received from chans, one channel at a time
+func Bridge[T any](ctx context.Context, chans <-chan (<-chan T)) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			var stream <-chan T
+			select {
+			case ch, ok := <-chans:
+				if !ok {
+					return
+				}
+				stream = ch
+			case <-ctx.Done():
+				return
+			}
+			for v := range OrDone(ctx, stream) {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
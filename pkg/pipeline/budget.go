@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DEADLINE BUDGETS
+// A deadline on the context of Run is shared by every stage: a value stuck in the first stage can spend it all
+// and the later stages get nothing left (or a context that is already done). A budget splits the remaining time
+// of the deadline into one share per stage, every value gets its own context with the share of the stage
+// it's in, so a slow stage fails fast instead of starving the ones after it.
+
+// ErrBudgetExceeded is returned by a stage that used up its share of the deadline
+var ErrBudgetExceeded = errors.New("pipeline: stage budget exceeded")
+
+// Budget splits the time left until the deadline between the stages, a share of zero means no budget
+type Budget func(total time.Duration, stages int) []time.Duration
+
+// Proportional splits the time in proportion to the weights, one per stage,
+// stages without a weight weigh 1 so Proportional() splits it in equal parts
+func Proportional(weights ...float64) Budget {
+	return func(total time.Duration, stages int) []time.Duration {
+		w := make([]float64, stages)
+		var sum float64
+		for i := range w {
+			w[i] = 1
+			if i < len(weights) {
+				w[i] = max(weights[i], 0)
+			}
+			sum += w[i]
+		}
+		shares := make([]time.Duration, stages)
+		if sum == 0 {
+			return shares
+		}
+		for i := range shares {
+			shares[i] = time.Duration(float64(total) * w[i] / sum)
+		}
+		return shares
+	}
+}
+
+// Fixed gives every stage the duration at its position, whatever the deadline,
+// stages without a duration have no budget
+func Fixed(durations ...time.Duration) Budget {
+	return func(total time.Duration, stages int) []time.Duration {
+		shares := make([]time.Duration, stages)
+		copy(shares, durations)
+		return shares
+	}
+}
+
+// Budget splits the deadline of the context passed to Run between the stages,
+// it does nothing if the context has no deadline
+func (p *Pipeline[T]) Budget(b Budget) *Pipeline[T] {
+	p.budget = b
+	return p
+}
+
+// budgets returns the share of every stage for a Run with the given context, nil without budgets
+func (p *Pipeline[T]) budgets(ctx context.Context) []time.Duration {
+	deadline, ok := ctx.Deadline()
+	if p.budget == nil || !ok {
+		return nil
+	}
+	return p.budget(time.Until(deadline), len(p.stages))
+}
+
+// budgeted calls fn with a context that expires after d
+func budgeted[T any](fn StageFunc[T], d time.Duration) StageFunc[T] {
+	return func(ctx context.Context, v T) (T, error) {
+		ctx, cancel := context.WithTimeoutCause(ctx, d, ErrBudgetExceeded)
+		defer cancel()
+		res, err := fn(ctx, v)
+		if err != nil && errors.Is(context.Cause(ctx), ErrBudgetExceeded) {
+			return res, fmt.Errorf("%w (%v): %w", ErrBudgetExceeded, d, err)
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,554 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/bulkhead"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/semaphore"
+)
+
+// BUILDER
+// Wiring the stages by hand (like in main) means repeating the same plumbing for every pipeline.
+// The builder owns that plumbing: it connects the source, the stages and the sink with channels
+// and takes care of the context, so users only write what happens to each value.
+
+// ErrNoSource is returned by Run when the pipeline has nothing to read from
+var ErrNoSource = errors.New("pipeline: no source")
+
+// ErrShutdown is the cause of the cancellation of the source context when Shutdown is called
+var ErrShutdown = errors.New("pipeline: shutting down")
+
+// SourceFunc is the first stage of a pipeline, it returns the channel the rest of the pipeline reads from
+type SourceFunc[T any] func(ctx context.Context) <-chan T
+
+// StageFunc transforms a single value, the builder runs it inside its own goroutine
+// returning an error stops the whole pipeline
+type StageFunc[T any] func(ctx context.Context, v T) (T, error)
+
+// SinkFunc is the last stage of a pipeline, it consumes every value that reaches the end
+// returning an error stops the whole pipeline
+type SinkFunc[T any] func(ctx context.Context, v T) error
+
+// Pipeline composes a source, a list of stages and a sink
+type Pipeline[T any] struct {
+	source  SourceFunc[T]
+	stages  []stage[T]
+	sink    SinkFunc[T]
+	metrics Metrics
+	recover *recoverPolicy
+	tracer  Tracer
+
+	middleware []Middleware[T]
+
+	checkpoint *checkpoint[T]
+
+	hooks    hooks
+	batching *batching
+	budget   Budget
+	sides    []sideOutput
+
+	mu      sync.Mutex
+	current *run // the Run in progress, if any
+	pending bool // Shutdown was called while not running, the next Run stops its source right away
+
+	id         string // set by ID or Register
+	registered bool   // listed by DebugHandler
+	logger     *slog.Logger
+	shared     *semaphore.Weighted // set by a Controller with a Limit
+	last       *run                // the last Run, kept for Status
+	started    time.Time           // of the last Run
+	lastErr    error               // of the last Run that failed
+}
+
+// stage is a stage function together with its options
+type stage[T any] struct {
+	fn   StageFunc[T]
+	opts stageOptions
+}
+
+// New creates an empty pipeline
+func New[T any]() *Pipeline[T] {
+	return &Pipeline[T]{}
+}
+
+// Source sets a fixed list of values as the source of the pipeline
+func (p *Pipeline[T]) Source(values ...T) *Pipeline[T] {
+	return p.From(func(ctx context.Context) <-chan T {
+		return Generate(ctx, values...)
+	})
+}
+
+// From sets any channel producer as the source of the pipeline
+func (p *Pipeline[T]) From(src SourceFunc[T]) *Pipeline[T] {
+	p.source = src
+	p.checkpoint = nil
+	return p
+}
+
+// Stage appends a stage to the pipeline, stages run in the order they were added,
+// the channel of the stage is unbuffered unless WithBuffer says otherwise
+// and the stage is called "stage i" unless WithName says otherwise
+func (p *Pipeline[T]) Stage(fn StageFunc[T], opts ...Option) *Pipeline[T] {
+	o := newStageOptions(opts)
+	if o.name == "" {
+		o.name = stageName(len(p.stages))
+	}
+	p.stages = append(p.stages, stage[T]{fn: fn, opts: o})
+	return p
+}
+
+// Sink sets the function that consumes the output of the pipeline
+// without a sink the output is drained and discarded
+func (p *Pipeline[T]) Sink(fn SinkFunc[T]) *Pipeline[T] {
+	p.sink = fn
+	return p
+}
+
+// ERROR PROPAGATION
+// A stage that fails can't just drop the value and keep going, the rest of the pipeline would never know.
+// Like errgroup, the first error is kept, the context shared by every stage is cancelled with that error
+// as its cause (upstream and downstream goroutines exit early, context.Cause tells them why) and Run returns it.
+
+// Run wires every stage and blocks until the source is exhausted, a stage fails or the context is cancelled,
+// a pipeline runs only once at a time
+func (p *Pipeline[T]) Run(ctx context.Context) error {
+	return p.execute(ctx, p.sink, nil)
+}
+
+// execute runs the pipeline with the given sink, with a warm-up the source waits until it's opened
+func (p *Pipeline[T]) execute(ctx context.Context, sink SinkFunc[T], warm *warmup) error {
+	if p.source == nil && p.checkpoint == nil {
+		return ErrNoSource
+	}
+
+	var tracker *Tracker
+	if p.checkpoint != nil {
+		var err error
+		if tracker, err = NewTracker(ctx, p.checkpoint.store); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	id, registered, shared := p.id, p.registered, p.shared
+	p.mu.Unlock()
+	if id != "" {
+		ctx = context.WithValue(ctx, pipelineIDKey{}, id)
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil) // stops every stage goroutine when the run is over
+
+	// the source gets its own context so it can be stopped without stopping the stages
+	srcCtx, stopSource := context.WithCancelCause(ctx)
+	defer stopSource(nil)
+
+	r := &run{
+		ctx:        ctx,
+		errs:       &errOnce{cancel: cancel},
+		cancel:     cancel,
+		stopSource: stopSource,
+		done:       make(chan struct{}),
+		registered: registered,
+		tracker:    tracker,
+		log:        p.runLogger(id),
+		budgets:    p.budgets(ctx),
+		shared:     shared,
+	}
+	ctx, closeSides := p.startSideOutputs(ctx, r)
+	r.ctx = ctx
+	p.mu.Lock()
+	p.current, p.last, p.started = r, r, time.Now()
+	if p.pending {
+		p.pending = false
+		stopSource(ErrShutdown) // shut down before it started
+	}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.current = nil
+		p.mu.Unlock()
+		close(r.done)
+	}()
+
+	p.hooks.onStart(ctx)
+	if r.log != nil {
+		r.log.Info("pipeline started", "stages", len(p.stages))
+		r.running.Store(int64(len(p.stages)))
+	}
+
+	source := func() <-chan T {
+		if tracker != nil {
+			return p.checkpoint.source(srcCtx, tracker.Next())
+		}
+		return p.source(srcCtx)
+	}
+	var src <-chan T
+	if warm != nil {
+		src = gated(srcCtx, warm.open, source)
+	} else {
+		src = source()
+	}
+
+	drain := func(v T) {
+		if ctx.Err() != nil {
+			return // keep draining so upstream stages can exit
+		}
+		if err := p.consume(ctx, sink, tracker, v); err != nil {
+			p.hooks.onStageError("sink", err)
+			if r.log != nil {
+				r.log.Error("item failed", "stage", "sink", "error", err)
+			}
+			r.errs.set(err)
+		}
+	}
+	if p.batching != nil {
+		// batched with the run context: a Shutdown closes the source and the last partial batch still goes downstream
+		out := batchSource(ctx, src, *p.batching)
+		for i := range p.stages {
+			out = p.runBatchedStage(r, i, out)
+		}
+		warm.ready()
+		for batch := range out {
+			for _, v := range batch {
+				drain(v)
+			}
+		}
+	} else {
+		recv := fromChan(src)
+		for i := range p.stages {
+			recv = p.runStage(r, i, recv)
+		}
+		warm.ready()
+		for v, ok := recv(); ok; v, ok = recv() {
+			drain(v)
+		}
+	}
+	closeSides() // every stage has exited, nobody can Emit anymore
+	r.wg.Wait()
+
+	err := r.errs.get()
+	if err == nil {
+		err = context.Cause(parent) // nil if the parent is not done
+	}
+	if err != nil {
+		p.mu.Lock()
+		p.lastErr = err
+		p.mu.Unlock()
+	}
+	if r.log != nil {
+		r.log.Info("pipeline stopped", "error", err)
+	}
+	p.hooks.onStop(err)
+	return err
+}
+
+// consume hands a value to the sink and acknowledges its offset
+func (p *Pipeline[T]) consume(ctx context.Context, sink SinkFunc[T], tracker *Tracker, v T) error {
+	if sink != nil {
+		if err := sink(ctx, v); err != nil {
+			return fmt.Errorf("pipeline: sink: %w", err)
+		}
+	}
+	if tracker != nil {
+		return tracker.Ack(ctx, p.checkpoint.offset(v))
+	}
+	return nil
+}
+
+// run holds the state shared by the goroutines of a single Run
+type run struct {
+	ctx  context.Context
+	wg   sync.WaitGroup
+	errs *errOnce
+
+	cancel     context.CancelCauseFunc
+	stopSource context.CancelCauseFunc
+	done       chan struct{} // closed when Run returns
+
+	mu       sync.Mutex
+	queues   map[string]func() (length, capacity int) // the output of every stage, by stage name
+	counters map[string]*stageCounters                // only for registered pipelines, by stage name
+
+	registered bool                // the pipeline was registered when the Run started
+	tracker    *Tracker            // nil without a checkpoint
+	budgets    []time.Duration     // the share of the deadline of every stage, nil without a budget
+	shared     *semaphore.Weighted // the concurrency budget shared with other pipelines, if any
+
+	log     *slog.Logger // nil if the pipeline doesn't log
+	running atomic.Int64 // stages not stopped yet, only counted when logging
+}
+
+// track registers the output queue of a stage so it can be inspected while the pipeline runs
+func (r *run) track(stage string, depth func() (length, capacity int)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queues == nil {
+		r.queues = make(map[string]func() (int, int))
+	}
+	r.queues[stage] = depth
+}
+
+// depth returns the length and the capacity of the output queue of a stage
+func (r *run) depth(stage string) (length, capacity int, ok bool) {
+	r.mu.Lock()
+	depth, ok := r.queues[stage]
+	r.mu.Unlock()
+	if !ok {
+		return 0, 0, false
+	}
+	length, capacity = depth()
+	return length, capacity, true
+}
+
+// GRACEFUL SHUTDOWN
+// Cancelling the context is a hard stop: every value still flowing through the stages is dropped.
+// Shutdown only stops the source, the values already produced keep moving through the stages
+// and reach the sink, then the channels are closed one after the other and Run returns.
+
+// Shutdown stops the source of the running pipeline (with ErrShutdown as the cause) and waits until the in-flight
+// values have been processed, if the context is done first the pipeline is cancelled and the cause of the context is returned,
+// if the pipeline is not running yet the shutdown is kept for the next Run, which stops its source as soon as it starts
+func (p *Pipeline[T]) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	r := p.current
+	if r == nil {
+		p.pending = true // a Run that is starting right now must not miss it
+	}
+	p.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+
+	r.stopSource(ErrShutdown)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		r.cancel(context.Cause(ctx))
+		<-r.done
+		return context.Cause(ctx)
+	}
+}
+
+// receiver returns the next value sent by the previous stage, false once there are no more
+type receiver[T any] func() (T, bool)
+
+func fromChan[T any](ch <-chan T) receiver[T] {
+	return func() (T, bool) {
+		v, ok := <-ch
+		return v, ok
+	}
+}
+
+// runStage starts the goroutines that apply the i-th stage function to every value received from in
+func (p *Pipeline[T]) runStage(r *run, i int, in receiver[T]) receiver[T] {
+	w := p.newWorker(r, i)
+	if w.opts.lockFree && (i == len(p.stages)-1 || p.stages[i+1].opts.concurrency == 1) {
+		return p.runLockFreeStage(r, w, in)
+	}
+
+	out := make(chan T, w.opts.buffer)
+	r.track(w.name, func() (int, int) { return len(out), cap(out) })
+	p.startWorkers(r, w, func() {
+		for v, ok := in(); ok; v, ok = in() {
+			res, keep, stop := w.process(v)
+			if stop {
+				return
+			}
+			if !keep {
+				continue
+			}
+			sent, dropped := offer(r.ctx, out, res, w.opts.overflow)
+			if !sent {
+				return
+			}
+			if p.metrics != nil {
+				if dropped {
+					p.metrics.ItemDropped(w.name)
+				}
+				p.metrics.QueueDepth(w.name, len(out), cap(out))
+			}
+		}
+	}, func() {
+		close(out)
+	})
+	return fromChan(out)
+}
+
+// worker is what the goroutines of a stage share
+type worker[T any] struct {
+	p        *Pipeline[T]
+	r        *run
+	name     string
+	opts     stageOptions
+	ctx      context.Context
+	fn       StageFunc[T]
+	span     Span
+	counters *stageCounters // nil if the pipeline is not registered
+}
+
+// newWorker wraps the i-th stage function with everything configured on the pipeline
+func (p *Pipeline[T]) newWorker(r *run, i int) *worker[T] {
+	s := p.stages[i]
+	w := &worker[T]{p: p, r: r, name: s.opts.name, opts: s.opts, fn: s.fn}
+	if s.opts.bulkhead != nil {
+		w.fn = isolated(s.opts.bulkhead, w.fn)
+	}
+	if r.shared != nil {
+		w.fn = limited(r.shared, w.fn)
+	}
+	w.fn = chain(w.fn, p.middleware)
+	if s.opts.quarantine != nil {
+		w.fn = quarantined(s.opts.quarantine, w.fn)
+	}
+	if i < len(r.budgets) && r.budgets[i] > 0 {
+		w.fn = budgeted(w.fn, r.budgets[i])
+	}
+	if p.recover != nil {
+		w.fn = Recover(w.fn)
+	}
+	if r.registered {
+		w.counters = r.countersOf(w.name)
+	}
+	w.ctx = context.WithValue(r.ctx, stageNameKey{}, w.name)
+	if p.tracer != nil {
+		w.ctx, w.span = p.tracer.Start(w.ctx, w.name)
+		w.fn = Traced(p.tracer, w.name+" item", w.fn)
+	}
+	return w
+}
+
+// process applies the stage function to a value, keep is false if the value must be skipped
+// and stop is true if the worker must exit because the pipeline failed
+func (w *worker[T]) process(v T) (res T, keep, stop bool) {
+	var start time.Time
+	if w.p.metrics != nil {
+		start = time.Now() // not free, only paid when someone is measuring
+	}
+	res, err := w.fn(w.ctx, v)
+	if err != nil {
+		err = fmt.Errorf("pipeline: %s: %w", w.name, err)
+		w.p.hooks.onStageError(w.name, err)
+		if w.counters != nil {
+			w.counters.errors.Add(1)
+		}
+		skip := errors.Is(err, ErrQuarantined) || w.p.recover.skip(err)
+		if w.r.log != nil {
+			w.r.log.Error("item failed", "stage", w.name, "error", err, "skipped", skip)
+		}
+		if skip {
+			// a skipped value never reaches the sink, its offset is acknowledged here or the checkpoint would stop
+			if w.r.tracker != nil {
+				if err := w.r.tracker.Ack(w.ctx, w.p.checkpoint.offset(v)); err != nil {
+					w.r.errs.set(err)
+					return res, false, true
+				}
+			}
+			return res, false, false
+		}
+		w.r.errs.set(err)
+		return res, false, true
+	}
+	if w.p.metrics != nil {
+		w.p.metrics.ItemProcessed(w.name, time.Since(start))
+	}
+	if w.counters != nil {
+		w.counters.processed.Add(1)
+	}
+	return res, true, false
+}
+
+// startWorkers runs work in as many goroutines as the concurrency of the stage,
+// closeOut is called once the last one exits
+func (p *Pipeline[T]) startWorkers(r *run, w *worker[T], work func(), closeOut func()) {
+	// FAN-OUT to the workers of the stage, they all send to the same channel (FAN-IN)
+	// which is closed when the last one exits
+	if r.log != nil {
+		r.log.Info("stage started", "stage", w.name, "workers", w.opts.concurrency)
+	}
+	var workers sync.WaitGroup
+	workers.Add(w.opts.concurrency)
+	for range w.opts.concurrency {
+		go func() {
+			defer workers.Done()
+			if w.counters != nil {
+				w.counters.running.Add(1)
+				defer w.counters.running.Add(-1)
+			}
+			work()
+		}()
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		workers.Wait()
+		if w.span != nil {
+			w.span.End()
+		}
+		closeOut()
+		if r.log != nil {
+			// SHUTDOWN PROGRESS: which stages are still draining
+			r.log.Info("stage stopped", "stage", w.name, "remaining", r.running.Add(-1))
+		}
+		p.hooks.onStageExit(w.name)
+	}()
+}
+
+// isolated calls fn inside the bulkhead
+func isolated[T any](b *bulkhead.Bulkhead, fn StageFunc[T]) StageFunc[T] {
+	return func(ctx context.Context, v T) (T, error) {
+		return bulkhead.Call(ctx, b, func(ctx context.Context) (T, error) {
+			return fn(ctx, v)
+		})
+	}
+}
+
+func stageName(i int) string {
+	return fmt.Sprintf("stage %d", i)
+}
+
+type stageNameKey struct{}
+
+// StageName returns the name of the stage running the function that received the context
+func StageName(ctx context.Context) string {
+	name, _ := ctx.Value(stageNameKey{}).(string)
+	return name
+}
+
+type pipelineIDKey struct{}
+
+// PipelineID returns the id of the pipeline running the function that received the context, empty if it has none
+func PipelineID(ctx context.Context) string {
+	id, _ := ctx.Value(pipelineIDKey{}).(string)
+	return id
+}
+
+// errOnce keeps the first error reported by any stage and cancels the pipeline with it as the cause
+type errOnce struct {
+	mu     sync.Mutex
+	err    error
+	cancel context.CancelCauseFunc
+}
+
+func (e *errOnce) set(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+		e.cancel(err)
+	}
+}
+
+func (e *errOnce) get() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CHECKPOINTS
+// A pipeline that crashes or restarts has to process everything again, unless it remembers how far it got.
+// Every value has an offset (position in the source). An offset is acknowledged once the sink is done with it,
+// and the checkpoint is the first offset not acknowledged yet: with parallel stages values finish out of order,
+// so the checkpoint only moves forward when every offset before it has been acknowledged.
+// On restart the source starts again from the checkpoint (values after it may be processed twice).
+
+// Checkpointer stores the checkpoint of a pipeline
+type Checkpointer interface {
+	// Load returns the offset the source should start from, zero if there is no checkpoint yet
+	Load(ctx context.Context) (int64, error)
+	// Save records the offset the source should start from after a restart
+	Save(ctx context.Context, offset int64) error
+}
+
+// MemoryCheckpointer keeps the checkpoint in memory, it survives a pipeline restart but not a process restart
+type MemoryCheckpointer struct {
+	mu     sync.Mutex
+	offset int64
+}
+
+// Load implements Checkpointer
+func (m *MemoryCheckpointer) Load(context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.offset, nil
+}
+
+// Save implements Checkpointer
+func (m *MemoryCheckpointer) Save(_ context.Context, offset int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offset = offset
+	return nil
+}
+
+// FileCheckpointer keeps the checkpoint in a file, it's replaced atomically on every save
+type FileCheckpointer struct {
+	Path string
+}
+
+// Load implements Checkpointer
+func (f FileCheckpointer) Load(context.Context) (int64, error) {
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// Save implements Checkpointer
+func (f FileCheckpointer) Save(_ context.Context, offset int64) error {
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// Tracker follows the acknowledged offsets and saves the checkpoint every time it moves forward
+type Tracker struct {
+	store Checkpointer
+
+	mu    sync.Mutex
+	next  int64              // first offset not acknowledged yet
+	acked map[int64]struct{} // acknowledged offsets after next
+}
+
+// NewTracker loads the last checkpoint from the store
+func NewTracker(ctx context.Context, store Checkpointer) (*Tracker, error) {
+	next, err := store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline: load checkpoint: %w", err)
+	}
+	return &Tracker{store: store, next: next, acked: make(map[int64]struct{})}, nil
+}
+
+// Next returns the checkpoint, the offset the source should start from
+func (t *Tracker) Next() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.next
+}
+
+// Ack acknowledges an offset and saves the checkpoint if it moved forward
+func (t *Tracker) Ack(ctx context.Context, offset int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if offset < t.next {
+		return nil // already covered by the checkpoint
+	}
+	t.acked[offset] = struct{}{}
+
+	moved := false
+	for {
+		if _, ok := t.acked[t.next]; !ok {
+			break
+		}
+		delete(t.acked, t.next)
+		t.next++
+		moved = true
+	}
+	if !moved {
+		return nil
+	}
+	if err := t.store.Save(ctx, t.next); err != nil {
+		return fmt.Errorf("pipeline: save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// checkpoint is the configuration set by FromCheckpoint
+type checkpoint[T any] struct {
+	store  Checkpointer
+	source func(ctx context.Context, from int64) <-chan T
+	offset func(T) int64
+}
+
+// FromCheckpoint sets a source that can resume: on Run it starts from the last checkpoint in the store,
+// and every value is acknowledged (by its offset) once the sink returns without error.
+// Every offset must reach the sink, a value dropped on the way stops the checkpoint from moving forward,
+// except the values skipped by Recover or WithQuarantine, which are acknowledged when they are skipped.
+func (p *Pipeline[T]) FromCheckpoint(store Checkpointer, src func(ctx context.Context, from int64) <-chan T, offset func(T) int64) *Pipeline[T] {
+	p.source = nil
+	p.checkpoint = &checkpoint[T]{store: store, source: src, offset: offset}
+	return p
+}
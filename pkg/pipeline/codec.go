@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+)
+
+// CODECS
+// Sources and sinks deal with bytes (files, sockets, queues), stages with typed values.
+// Encoding and decoding is CPU work that is independent for every value, so it runs in parallel
+// workers with MapConcurrent and the values keep their order. A value that can't be converted
+// goes to the dead-letter channel instead of stopping the stream.
+
+// DecodeJSON unmarshals every JSON document received from in into a T with n workers,
+// the documents that fail are sent to the second channel, both channels must be read
+func DecodeJSON[T any](ctx context.Context, in <-chan []byte, n int) (<-chan T, <-chan Failed[[]byte]) {
+	return convert(ctx, in, n, func(b []byte) (T, error) {
+		var v T
+		err := json.Unmarshal(b, &v)
+		return v, err
+	})
+}
+
+// EncodeJSON marshals every value received from in into a JSON document ending with a new line (JSON lines)
+// with n workers, the values that fail are sent to the second channel, both channels must be read
+func EncodeJSON[T any](ctx context.Context, in <-chan T, n int) (<-chan []byte, <-chan Failed[T]) {
+	return convert(ctx, in, n, func(v T) ([]byte, error) {
+		b, err := json.Marshal(v)
+		return append(b, '\n'), err
+	})
+}
+
+// DecodeCSV parses every CSV record received from in and converts its fields with parse using n workers,
+// the records that fail are sent to the second channel, both channels must be read
+func DecodeCSV[T any](ctx context.Context, in <-chan []byte, n int, parse func(fields []string) (T, error)) (<-chan T, <-chan Failed[[]byte]) {
+	return convert(ctx, in, n, func(b []byte) (T, error) {
+		fields, err := csv.NewReader(bytes.NewReader(b)).Read()
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return parse(fields)
+	})
+}
+
+// EncodeCSV converts every value received from in into the fields of a CSV record with format using n workers,
+// the values that fail are sent to the second channel, both channels must be read
+func EncodeCSV[T any](ctx context.Context, in <-chan T, n int, format func(T) ([]string, error)) (<-chan []byte, <-chan Failed[T]) {
+	return convert(ctx, in, n, func(v T) ([]byte, error) {
+		fields, err := format(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(fields); err != nil {
+			return nil, err
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	})
+}
+
+// convert applies fn to every value with n workers keeping the order, the failures go to the second channel
+func convert[In, Out any](ctx context.Context, in <-chan In, n int, fn func(In) (Out, error)) (<-chan Out, <-chan Failed[In]) {
+	type result struct {
+		in  In
+		out Out
+		err error
+	}
+	results := MapConcurrent(ctx, in, n, func(v In) result {
+		res, err := fn(v)
+		return result{in: v, out: res, err: err}
+	})
+
+	out := make(chan Out)
+	dead := make(chan Failed[In])
+	go func() {
+		defer close(out)
+		defer close(dead)
+		for r := range results {
+			if r.err != nil {
+				if !send(ctx, dead, Failed[In]{Value: r.in, Err: r.err, Attempts: 1}) {
+					return
+				}
+				continue
+			}
+			if !send(ctx, out, r.out) {
+				return
+			}
+		}
+	}()
+	return out, dead
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+)
+
+// PARALLEL COMPRESSION
+// gzip compresses a stream in a single goroutine, one core does all the work.
+// A gzip file can be made of several gzip streams one after the other (gzip.Reader reads them as one),
+// so the input is cut in blocks, the blocks are compressed in parallel and written back in order (like pigz).
+// Each compressed block is a complete gzip stream, which also lets them be decompressed in parallel.
+// (zstd works the same way but it's not in the standard library)
+
+// DefaultBlockSize is the size of the blocks compressed by Compress when blockSize is not positive
+const DefaultBlockSize = 128 << 10
+
+// Compress cuts the bytes received from in into blocks of blockSize and compresses them with n workers at the given
+// gzip level, the compressed blocks are sent in order and written one after the other form a valid gzip file,
+// the first error is sent to the second channel and stops the stage, an invalid level is sent before reading in
+func Compress(ctx context.Context, in <-chan []byte, blockSize, n, level int) (<-chan []byte, <-chan error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		out, errc := make(chan []byte), make(chan error, 1)
+		close(out)
+		errc <- err
+		close(errc)
+		return out, errc
+	}
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	ctx, cancel := context.WithCancel(ctx) // an error must also stop Blocks, not only the workers
+	return transcode(ctx, cancel, Blocks(ctx, in, blockSize), n, func(block []byte) ([]byte, error) {
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(block); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	})
+}
+
+// Decompress decompresses every gzip stream received from in (like the blocks sent by Compress) with n workers,
+// the results are sent in order, the first error is sent to the second channel and stops the stage
+func Decompress(ctx context.Context, in <-chan []byte, n int) (<-chan []byte, <-chan error) {
+	ctx, cancel := context.WithCancel(ctx)
+	return transcode(ctx, cancel, in, n, func(block []byte) ([]byte, error) {
+		r, err := gzip.NewReader(bytes.NewReader(block))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	})
+}
+
+// Blocks regroups the bytes received from in into blocks of exactly size bytes, the last one can be shorter
+func Blocks(ctx context.Context, in <-chan []byte, size int) <-chan []byte {
+	size = max(size, 1)
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		block := make([]byte, 0, size)
+		for b := range OrDone(ctx, in) {
+			for len(b) > 0 {
+				k := min(size-len(block), len(b))
+				block, b = append(block, b[:k]...), b[k:]
+				if len(block) == size {
+					if !send(ctx, out, block) {
+						return
+					}
+					block = make([]byte, 0, size) // the one sent belongs to the consumer now
+				}
+			}
+		}
+		if len(block) > 0 {
+			send(ctx, out, block)
+		}
+	}()
+	return out
+}
+
+// transcode applies fn to every block with n workers keeping the order, it stops at the first error
+// and calls cancel, which must cancel ctx and the stage feeding in
+func transcode(ctx context.Context, cancel context.CancelFunc, in <-chan []byte, n int, fn func([]byte) ([]byte, error)) (<-chan []byte, <-chan error) {
+	type result struct {
+		b   []byte
+		err error
+	}
+	results := MapConcurrent(ctx, in, n, func(b []byte) result {
+		res, err := fn(b)
+		return result{b: res, err: err}
+	})
+
+	out := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errc)
+		defer cancel() // stops the workers, the blocks still in flight and Blocks
+		for r := range results {
+			if r.err != nil {
+				errc <- r.err
+				return
+			}
+			if !send(ctx, out, r.b) {
+				return
+			}
+		}
+	}()
+	return out, errc
+}
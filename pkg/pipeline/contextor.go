@@ -0,0 +1,45 @@
+package pipeline
+
+import "context"
+
+// CONTEXT OR
+// A stage serving many tenants has two reasons to stop: the pipeline is shutting down (the context of the stage)
+// or the tenant is gone (the context of its request). Selecting on both everywhere doesn't work with functions
+// that take a single context, so ContextOr merges them: the result is done as soon as any of them is done,
+// and context.Cause tells which one (and why).
+
+// ContextOr returns a context that is done when any of ctxs is done, with the cause of the first one done,
+// its values and its deadline come from ctxs[0] unless another one has an earlier deadline,
+// cancel releases the resources and must be called once the context is not needed anymore
+func ContextOr(ctxs ...context.Context) (context.Context, context.CancelFunc) {
+	if len(ctxs) == 0 {
+		return context.WithCancel(context.Background())
+	}
+	ctx, cancelCause := context.WithCancelCause(ctxs[0])
+	stops := make([]func() bool, 0, len(ctxs)-1)
+	for _, other := range ctxs[1:] {
+		stops = append(stops, context.AfterFunc(other, func() {
+			cancelCause(context.Cause(other))
+		}))
+	}
+
+	// Deadline must report the earliest one, the Done of the others is already covered by AfterFunc
+	cancelDeadline := func() {}
+	deadline, ok := ctx.Deadline()
+	for _, other := range ctxs[1:] {
+		if d, has := other.Deadline(); has && (!ok || d.Before(deadline)) {
+			deadline, ok = d, true
+		}
+	}
+	if first, has := ctxs[0].Deadline(); ok && (!has || deadline.Before(first)) {
+		ctx, cancelDeadline = context.WithDeadline(ctx, deadline)
+	}
+
+	return ctx, func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancelDeadline()
+		cancelCause(context.Canceled)
+	}
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/semaphore"
+)
+
+// CONTROLLER
+// A service rarely runs a single pipeline: it ingests from a queue, compacts files and sends reports at the same time.
+// A controller owns all of them: it starts them together, shares one budget of concurrent stage calls between them
+// (so a busy pipeline can't take every CPU), and on SIGINT/SIGTERM shuts them all down gracefully
+// (a second signal cancels them) before returning every error they produced.
+
+// Runnable is a pipeline of any type, *Pipeline[T] implements it,
+// a Shutdown called before Run must stop the Run that comes next, a signal can arrive before a pipeline has started
+type Runnable interface {
+	Run(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+// sharer is implemented by the pipelines that can take part in a shared concurrency budget
+type sharer interface {
+	share(sem *semaphore.Weighted)
+}
+
+// Controller runs several pipelines as one, the zero value is ready to use
+type Controller struct {
+	// Limit is the number of stage calls running at the same time across every pipeline, 0 means no limit
+	Limit int
+	// ShutdownTimeout bounds the graceful shutdown, the pipelines still running after it are cancelled, 0 means no bound
+	ShutdownTimeout time.Duration
+	// Signals start the graceful shutdown, SIGINT and SIGTERM if empty
+	Signals []os.Signal
+
+	pipelines []Runnable
+}
+
+// Add adds pipelines to the controller, it must not be called while the controller is running
+func (c *Controller) Add(pipelines ...Runnable) {
+	c.pipelines = append(c.pipelines, pipelines...)
+}
+
+// Run runs every pipeline until all of them return, a failing pipeline doesn't stop the others,
+// a signal shuts them down gracefully, a second signal or cancelling ctx cancels them, it returns their errors joined
+func (c *Controller) Run(ctx context.Context) error {
+	signals := c.Signals
+	if len(signals) == 0 {
+		signals = defaultSignals
+	}
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, signals...)
+	defer signal.Stop(sigs)
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var sem *semaphore.Weighted
+	if c.Limit > 0 {
+		sem = semaphore.New(int64(c.Limit))
+	}
+
+	errs := make([]error, len(c.pipelines))
+	var running sync.WaitGroup
+	for i, p := range c.pipelines {
+		if s, ok := p.(sharer); ok {
+			s.share(sem)
+		}
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			errs[i] = p.Run(runCtx)
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-sigs:
+		// GRACEFUL DRAIN, unless a second signal arrives first
+		go func() {
+			select {
+			case <-sigs:
+				cancel(ErrInterrupted)
+			case <-done:
+			}
+		}()
+		c.shutdown(runCtx, cancel)
+		<-done
+	}
+	return errors.Join(errs...)
+}
+
+// shutdown shuts every pipeline down at the same time and cancels the ones still running after the timeout
+func (c *Controller) shutdown(ctx context.Context, cancel context.CancelCauseFunc) {
+	if c.ShutdownTimeout > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeoutCause(ctx, c.ShutdownTimeout, ErrShutdown)
+		defer stop()
+	}
+	var wg sync.WaitGroup
+	for _, p := range c.pipelines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = p.Shutdown(ctx)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		cancel(context.Cause(ctx))
+	}
+}
+
+// share makes the stages of the pipeline take a slot of sem for every call, nil removes the budget
+func (p *Pipeline[T]) share(sem *semaphore.Weighted) {
+	p.mu.Lock()
+	p.shared = sem
+	p.mu.Unlock()
+}
+
+// limited calls fn holding a slot of sem
+func limited[T any](sem *semaphore.Weighted, fn StageFunc[T]) StageFunc[T] {
+	return func(ctx context.Context, v T) (T, error) {
+		return semaphore.Call(ctx, sem, func(ctx context.Context) (T, error) {
+			return fn(ctx, v)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// CREDIT-BASED FLOW CONTROL
+// A channel buffer bounds the values waiting between two stages, not the values the consumer is working on:
+// a consumer that hands values to other goroutines keeps reading and the producer never slows down.
+// With credits the consumer says how many values it can take, the producer spends one credit per value
+// and waits when it runs out, the consumer gives a credit back when it's really done with a value.
+
+// Credits are the values a consumer is ready to take, the zero value has no credits
+type Credits struct {
+	mu   sync.Mutex
+	n    int
+	wake chan struct{} // closed and replaced every time credits are granted
+}
+
+// NewCredits returns credits with n granted up front
+func NewCredits(n int) *Credits {
+	c := &Credits{}
+	c.Grant(n)
+	return c
+}
+
+// Grant gives the producer n more credits, it's how the consumer asks for more values
+func (c *Credits) Grant(n int) {
+	if n <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n += n
+	if c.wake != nil {
+		close(c.wake) // WAKE UP the producer waiting for credits
+		c.wake = nil
+	}
+}
+
+// Acquire spends a credit, waiting until one is granted or the context is done
+func (c *Credits) Acquire(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if c.n > 0 {
+			c.n--
+			c.mu.Unlock()
+			return nil
+		}
+		if c.wake == nil {
+			c.wake = make(chan struct{})
+		}
+		wake := c.wake
+		c.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// Available returns the credits not spent yet
+func (c *Credits) Available() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// Credited is a value sent with a credit, Done gives the credit back to the producer
+type Credited[T any] struct {
+	Value T
+
+	credits *Credits
+}
+
+// Done replenishes the credit spent on the value, it must be called once the value is processed
+func (c Credited[T]) Done() {
+	if c.credits != nil {
+		c.credits.Grant(1)
+	}
+}
+
+// CreditFlow forwards the values received from in spending a credit for each of them,
+// the input is not read while there are no credits left, so the values in flight never exceed the credits granted
+func CreditFlow[T any](ctx context.Context, in <-chan T, credits *Credits) <-chan Credited[T] {
+	out := make(chan Credited[T])
+	go func() {
+		defer close(out)
+		for {
+			// the credit is spent before reading, a value is never held while waiting for one
+			if credits.Acquire(ctx) != nil {
+				return
+			}
+			var v T
+			var ok bool
+			select {
+			case v, ok = <-in:
+			case <-ctx.Done():
+				return
+			}
+			if !ok {
+				credits.Grant(1) // not spent
+				return
+			}
+			if !send(ctx, out, Credited[T]{Value: v, credits: credits}) {
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,37 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PARTIAL RESULTS
+// A search that must answer in 200ms is better off returning the results found so far than an error.
+// RunWithDeadline cancels the pipeline when the time is up, like a context with a timeout would,
+// but keeps the values that already reached the end and tells the caller the result is truncated.
+
+// errDeadline is the cause of the cancellation of RunWithDeadline
+var errDeadline = errors.New("pipeline: deadline")
+
+// RunWithDeadline runs the pipeline for at most d and returns the values that reached the end of it
+// (and were accepted by the sink, if there is one), truncated is true if the time was up before the source was exhausted,
+// which is not an error
+func (p *Pipeline[T]) RunWithDeadline(ctx context.Context, d time.Duration) (res []T, truncated bool, err error) {
+	dctx, cancel := context.WithTimeoutCause(ctx, d, errDeadline)
+	defer cancel()
+
+	err = p.execute(dctx, func(ctx context.Context, v T) error {
+		if p.sink != nil {
+			if err := p.sink(ctx, v); err != nil {
+				return err
+			}
+		}
+		res = append(res, v)
+		return nil
+	}, nil)
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(dctx), errDeadline) {
+		return res, true, nil
+	}
+	return res, false, err
+}
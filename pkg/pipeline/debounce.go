@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+)
+
+// DEBOUNCE AND SAMPLE
+// Event sources like file watchers or UI events come in bursts: ten events for a single save.
+// Debounce waits until the burst is over and only sends the last value,
+// Sample sends the latest value once per interval no matter how many arrived.
+
+// Debounce sends a value only after d has passed without receiving a newer one, it accepts WithClock
+func Debounce[T any](ctx context.Context, in <-chan T, d time.Duration, opts ...Option) <-chan T {
+	o := newStageOptions(opts)
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		timer := o.clock.NewTimer(d)
+		stopTimer(timer)
+		defer timer.Stop()
+
+		var last T
+		var pending bool
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					if pending {
+						send(ctx, out, last)
+					}
+					return
+				}
+				last, pending = v, true
+				stopTimer(timer)
+				timer.Reset(d)
+			case <-timer.C():
+				pending = false
+				if !send(ctx, out, last) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Sample sends the latest value received from in once every d, intervals without values send nothing,
+// it accepts WithClock
+func Sample[T any](ctx context.Context, in <-chan T, d time.Duration, opts ...Option) <-chan T {
+	o := newStageOptions(opts)
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		ticker := o.clock.NewTicker(d)
+		defer ticker.Stop()
+
+		var last T
+		var pending bool
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					if pending {
+						send(ctx, out, last)
+					}
+					return
+				}
+				last, pending = v, true
+			case <-ticker.C():
+				if !pending {
+					continue
+				}
+				pending = false
+				if !send(ctx, out, last) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// send sends v unless the context is done first, it reports whether it was sent
+func send[T any](ctx context.Context, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// stopTimer stops the timer and drains its channel, so it can be reset safely
+func stopTimer(t clock.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C():
+		default:
+		}
+	}
+}
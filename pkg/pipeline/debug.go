@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// INTROSPECTION
+// When a pipeline stalls in production the questions are always the same: is it running, which stage
+// is stuck, how many goroutines does it have, what was the last error. Registered pipelines count
+// the values and the errors of every stage, and DebugHandler shows them like net/http/pprof shows profiles.
+// Unregistered pipelines don't pay for the counters.
+
+// Status is a snapshot of a registered pipeline
+type Status struct {
+	ID        string        `json:"id"`
+	Running   bool          `json:"running"`
+	Started   time.Time     `json:"started,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+	Stages    []StageStatus `json:"stages"`
+}
+
+// StageStatus is a snapshot of a stage of a registered pipeline, the counters are for the current
+// (or the last) run
+type StageStatus struct {
+	Name       string  `json:"name"`
+	Workers    int     `json:"workers"`    // configured
+	Goroutines int     `json:"goroutines"` // running right now
+	Processed  int64   `json:"processed"`
+	Errors     int64   `json:"errors"`
+	Throughput float64 `json:"throughput"` // values per second since the run started
+	Queue      int     `json:"queue"`
+	Capacity   int     `json:"capacity"`
+}
+
+// stageCounters are the counters of a stage of a registered pipeline
+type stageCounters struct {
+	processed atomic.Int64
+	errors    atomic.Int64
+	running   atomic.Int64
+}
+
+// countersOf returns the counters of a stage, creating them if needed
+func (r *run) countersOf(stage string) *stageCounters {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counters == nil {
+		r.counters = make(map[string]*stageCounters)
+	}
+	c, ok := r.counters[stage]
+	if !ok {
+		c = &stageCounters{}
+		r.counters[stage] = c
+	}
+	return c
+}
+
+// inspectable is a pipeline of any type that can report its status
+type inspectable interface {
+	status() Status
+}
+
+var registry struct {
+	mu        sync.Mutex
+	pipelines map[string]inspectable
+}
+
+// ID identifies the pipeline in logs (Log) and in the context of its stages (PipelineID)
+func (p *Pipeline[T]) ID(id string) *Pipeline[T] {
+	p.mu.Lock()
+	p.id = id
+	p.mu.Unlock()
+	return p
+}
+
+// Register sets the id of the pipeline and lists it in DebugHandler,
+// registering another pipeline with the same id replaces it
+func (p *Pipeline[T]) Register(id string) *Pipeline[T] {
+	p.mu.Lock()
+	p.id, p.registered = id, true
+	p.mu.Unlock()
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.pipelines == nil {
+		registry.pipelines = make(map[string]inspectable)
+	}
+	registry.pipelines[id] = p
+	return p
+}
+
+// Unregister removes the pipeline from DebugHandler
+func (p *Pipeline[T]) Unregister() {
+	p.mu.Lock()
+	id := p.id
+	p.registered = false
+	p.mu.Unlock()
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.pipelines[id] == inspectable(p) {
+		delete(registry.pipelines, id)
+	}
+}
+
+// Statuses returns the status of every registered pipeline sorted by id
+func Statuses() []Status {
+	registry.mu.Lock()
+	pipelines := make([]inspectable, 0, len(registry.pipelines))
+	for _, p := range registry.pipelines {
+		pipelines = append(pipelines, p)
+	}
+	registry.mu.Unlock()
+
+	res := make([]Status, len(pipelines))
+	for i, p := range pipelines {
+		res[i] = p.status()
+	}
+	slices.SortFunc(res, func(a, b Status) int {
+		switch {
+		case a.ID < b.ID:
+			return -1
+		case a.ID > b.ID:
+			return 1
+		}
+		return 0
+	})
+	return res
+}
+
+func (p *Pipeline[T]) status() Status {
+	p.mu.Lock()
+	st := Status{ID: p.id, Running: p.current != nil, Started: p.started}
+	if p.lastErr != nil {
+		st.LastError = p.lastErr.Error()
+	}
+	r := p.last
+	p.mu.Unlock()
+
+	elapsed := time.Since(st.Started).Seconds()
+	for _, s := range p.stages {
+		ss := StageStatus{Name: s.opts.name, Workers: s.opts.concurrency}
+		if r != nil {
+			c := r.countersOf(ss.Name)
+			ss.Processed, ss.Errors, ss.Goroutines = c.processed.Load(), c.errors.Load(), int(c.running.Load())
+			if elapsed > 0 {
+				ss.Throughput = float64(ss.Processed) / elapsed
+			}
+			if st.Running {
+				ss.Queue, ss.Capacity, _ = r.depth(ss.Name)
+			}
+		}
+		st.Stages = append(st.Stages, ss)
+	}
+	return st
+}
+
+// DebugHandler returns a handler listing the registered pipelines, in plain text or in JSON with ?format=json,
+// e.g. http.Handle("/debug/pipelines", pipeline.DebugHandler())
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := Statuses()
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(statuses)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, st := range statuses {
+			state := "stopped"
+			if st.Running {
+				state = "running since " + st.Started.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "pipeline %s: %s\n", st.ID, state)
+			if st.LastError != "" {
+				fmt.Fprintf(w, "last error: %s\n", st.LastError)
+			}
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "STAGE\tWORKERS\tGOROUTINES\tPROCESSED\tERRORS\tTHROUGHPUT\tQUEUE")
+			for _, s := range st.Stages {
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.1f/s\t%d/%d\n",
+					s.Name, s.Workers, s.Goroutines, s.Processed, s.Errors, s.Throughput, s.Queue, s.Capacity)
+			}
+			_ = tw.Flush()
+			fmt.Fprintln(w)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
+// DEDUPLICATION
+// At-least-once sources (retries, redeliveries) send the same value more than once.
+// Remembering every key ever seen doesn't work on an infinite stream, so the stage only remembers
+// the keys seen within a window of time, and at most a fixed number of them: a list ordered by
+// the last time each key was seen gives both the expired keys and the least recently seen ones.
+
+// DefaultMaxKeys is the number of keys Dedup remembers when WithMaxKeys is not used
+const DefaultMaxKeys = 1 << 16
+
+// WithMaxKeys sets the maximum number of keys remembered by the stages that keep keys (Dedup)
+func WithMaxKeys(n int) Option {
+	return func(o *stageOptions) {
+		if n > 0 {
+			o.maxKeys = n
+		}
+	}
+}
+
+// Dedup drops the values whose key was already seen within the window, seeing a key again restarts its window,
+// when more than the maximum number of keys are remembered the least recently seen one is forgotten,
+// it accepts WithMaxKeys and WithClock
+func Dedup[T any, K comparable](ctx context.Context, in <-chan T, key func(T) K, window time.Duration, opts ...Option) <-chan T {
+	o := newStageOptions(opts)
+	maxKeys := o.maxKeys
+	if maxKeys == 0 {
+		maxKeys = DefaultMaxKeys
+	}
+
+	type entry struct {
+		key  K
+		seen time.Time
+	}
+
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		seen := make(map[K]*list.Element)
+		order := list.New() // of entry, least recently seen at the front
+
+		for v := range in {
+			now := o.clock.Now()
+			for e := order.Front(); e != nil && now.Sub(e.Value.(entry).seen) >= window; e = order.Front() {
+				delete(seen, order.Remove(e).(entry).key) // EXPIRED
+			}
+
+			k := key(v)
+			if e, ok := seen[k]; ok {
+				e.Value = entry{key: k, seen: now}
+				order.MoveToBack(e)
+				continue // DUPLICATE
+			}
+			seen[k] = order.PushBack(entry{key: k, seen: now})
+			if order.Len() > maxKeys {
+				delete(seen, order.Remove(order.Front()).(entry).key) // EVICT THE LEAST RECENTLY SEEN
+			}
+
+			if !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
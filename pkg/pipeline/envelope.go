@@ -0,0 +1,75 @@
+package pipeline
+
+import "context"
+
+// PER-ITEM CONTEXT
+// The pipeline context is shared by every value, but deadlines, trace ids or auth tokens belong to a single value
+// (the request that produced it). An envelope carries that context next to the value across stage boundaries.
+// It's the same exception to "don't use context instances as struct fields" that http.Request makes:
+// the envelope is a message that lives as long as the value, not a long-lived struct.
+
+// Envelope is a value together with its own context
+type Envelope[T any] struct {
+	ctx   context.Context
+	Value T
+
+	pooled bool // waiting in a Pool, only set until a Get hands it out again
+}
+
+// NewEnvelope wraps a value with its context
+func NewEnvelope[T any](ctx context.Context, v T) Envelope[T] {
+	return Envelope[T]{ctx: ctx, Value: v}
+}
+
+// Context returns the context of the value, never nil
+func (e Envelope[T]) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// WithContext returns a copy of the envelope carrying another context
+func (e Envelope[T]) WithContext(ctx context.Context) Envelope[T] {
+	e.ctx = ctx
+	return e
+}
+
+// Wrap puts every value received from in into an envelope, itemCtx derives the context of each value
+// from the pipeline context (deadlines, values...), a nil itemCtx gives every value the pipeline context
+func Wrap[T any](ctx context.Context, in <-chan T, itemCtx func(ctx context.Context, v T) context.Context) <-chan Envelope[T] {
+	return Lift(func(v T) Envelope[T] {
+		if itemCtx == nil {
+			return NewEnvelope(ctx, v)
+		}
+		return NewEnvelope(itemCtx(ctx, v), v)
+	})(ctx, in)
+}
+
+// Unwrap takes the values out of their envelopes
+func Unwrap[T any](ctx context.Context, in <-chan Envelope[T]) <-chan T {
+	return Lift(func(e Envelope[T]) T {
+		return e.Value
+	})(ctx, in)
+}
+
+// MapEnvelope calls fn with the context of every value and keeps that context for the result,
+// values whose context is already done are dropped instead of processed
+func MapEnvelope[T, U any](ctx context.Context, in <-chan Envelope[T], fn func(context.Context, T) U) <-chan Envelope[U] {
+	out := make(chan Envelope[U])
+	go func() {
+		defer close(out)
+		for e := range in {
+			itemCtx := e.Context()
+			if itemCtx.Err() != nil {
+				continue // deadline exceeded or cancelled upstream
+			}
+			select {
+			case out <- NewEnvelope(itemCtx, fn(itemCtx, e.Value)):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,79 @@
+package pipeline
+
+import "context"
+
+// FAIR FAN-IN
+// Merge sends whatever is ready first, so an input that always has a value ready can win most of the races
+// and a slow input waits much longer than it should. MergeFair reads every input into its own buffered lane
+// and a single goroutine takes at most one value from each lane per round (round-robin over the ready lanes),
+// so a busy input gets the same share of the output as any other and no input is starved.
+
+// MergeFair multiplexes the input channels onto a single channel taking turns between the inputs that have values,
+// every input can be up to buffer values ahead of the output, the channel is closed when all the inputs are closed
+func MergeFair[T any](ctx context.Context, buffer int, channels ...<-chan T) <-chan T {
+	out := make(chan T)
+	ready := make(chan struct{}, 1) // a lane got a value or was closed
+	notify := func() {
+		select {
+		case ready <- struct{}{}:
+		default: // the merger has already been told
+		}
+	}
+
+	lanes := make([]chan T, len(channels))
+	for i, ch := range channels {
+		lane := make(chan T, max(buffer, 1))
+		lanes[i] = lane
+		go func() {
+			defer notify()
+			defer close(lane)
+			for v := range ch {
+				select {
+				case lane <- v:
+					notify()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		open := len(lanes)
+		next := 0 // the lane served first in the next round
+		for open > 0 {
+			// ROUND-ROBIN: one value per lane and round
+			served := false
+			for range lanes {
+				i := next
+				next = (next + 1) % len(lanes)
+				if lanes[i] == nil {
+					continue
+				}
+				select {
+				case v, ok := <-lanes[i]:
+					if !ok {
+						lanes[i] = nil
+						open--
+						continue
+					}
+					if !send(ctx, out, v) {
+						return
+					}
+					served = true
+				default:
+				}
+			}
+			if served || open == 0 {
+				continue
+			}
+			select {
+			case <-ready:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,71 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline/pipelinetest"
+)
+
+// fast is an input that always has a value ready
+func fast(n int) <-chan int {
+	ch := make(chan int, n)
+	for range n {
+		ch <- 0
+	}
+	close(ch)
+	return ch
+}
+
+// slow is an input that takes a while to produce every value, but keeps ahead of the consumer
+func slow(n int, every time.Duration) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for range n {
+			time.Sleep(every)
+			ch <- 1
+		}
+	}()
+	return ch
+}
+
+func TestMergeFairNoStarvation(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	const n = 50
+	out := pipeline.MergeFair(context.Background(), 4, fast(10*n), slow(n, 50*time.Microsecond))
+
+	// the consumer is the bottleneck: both lanes have a value ready at every round,
+	// so the slow input gets one value out of two while it lasts
+	slowCount := 0
+	for range 2 * n {
+		if <-out == 1 {
+			slowCount++
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if want := n * 8 / 10; slowCount < want {
+		t.Errorf("slow input got %d of the first %d values, want at least %d", slowCount, 2*n, want)
+	}
+
+	rest := 0
+	for v := range out {
+		rest++
+		slowCount += v
+	}
+	if slowCount != n || rest+2*n != 11*n {
+		t.Errorf("got %d slow values and %d values in total, want %d and %d", slowCount, rest+2*n, n, 11*n)
+	}
+}
+
+func TestMergeFairStopsOnCancel(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := pipeline.MergeFair(ctx, 1, fast(100), fast(100))
+	<-out
+	cancel()
+	for range out {
+	}
+}
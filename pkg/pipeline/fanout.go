@@ -0,0 +1,38 @@
+package pipeline
+
+import "context"
+
+// FanOut starts n copies of the stage reading from the same input channel
+// and returns the output channel of every worker, parallelism becomes a parameter
+func FanOut[In, Out any](ctx context.Context, in <-chan In, n int, stage Stage[In, Out]) []<-chan Out {
+	if n < 1 {
+		n = 1
+	}
+	outs := make([]<-chan Out, n)
+	for i := range outs {
+		outs[i] = stage(ctx, in)
+	}
+	return outs
+}
+
+// Parallel fans out the stage to n workers and fans in their results onto a single channel
+func Parallel[In, Out any](ctx context.Context, in <-chan In, n int, stage Stage[In, Out]) <-chan Out {
+	return Merge(ctx, FanOut(ctx, in, n, stage)...)
+}
+
+// FanOutKeyed starts n copies of the stage like FanOut, but every value is routed by its key
+// so values with the same key are always processed by the same worker, in the order they were received
+func FanOutKeyed[In, Out any](ctx context.Context, in <-chan In, n int, key func(In) string, stage Stage[In, Out]) []<-chan Out {
+	parts := Partition(ctx, in, key, n)
+	outs := make([]<-chan Out, len(parts))
+	for i, part := range parts {
+		outs[i] = stage(ctx, part)
+	}
+	return outs
+}
+
+// ParallelKeyed fans out the stage by key and fans in the results onto a single channel,
+// the order is kept between values with the same key but not across keys
+func ParallelKeyed[In, Out any](ctx context.Context, in <-chan In, n int, key func(In) string, stage Stage[In, Out]) <-chan Out {
+	return Merge(ctx, FanOutKeyed(ctx, in, n, key, stage)...)
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+// CHUNKED FILES
+// Reading a large file line by line in a single goroutine makes the reader the bottleneck,
+// reading it whole doesn't fit in memory. Reading it in chunks of a fixed size gives the workers
+// big pieces of work with bounded memory. When the chunks are parsed independently they must end
+// at a record boundary, so a chunk is extended up to the next delimiter instead of cutting a record in two.
+
+// Chunk is a piece of a file and its position in it
+type Chunk struct {
+	Offset int64
+	Data   []byte
+}
+
+// ReadChunks reads r in chunks of size bytes (the last one can be shorter),
+// an error reading r is sent to the second channel and both channels are closed
+func ReadChunks(ctx context.Context, r io.Reader, size int) (<-chan Chunk, <-chan error) {
+	return readChunks(ctx, r, size, nil)
+}
+
+// ReadRecordChunks reads r in chunks of at least size bytes that end with delim (or at the end of r),
+// so no record is split between two chunks, an error reading r is sent to the second channel
+func ReadRecordChunks(ctx context.Context, r io.Reader, size int, delim byte) (<-chan Chunk, <-chan error) {
+	return readChunks(ctx, r, size, &delim)
+}
+
+// ReadFile opens the file and reads it with ReadRecordChunks, the file is closed when the chunks are read
+func ReadFile(ctx context.Context, path string, size int, delim byte) (<-chan Chunk, <-chan error) {
+	f, err := os.Open(path)
+	if err != nil {
+		out, errc := make(chan Chunk), make(chan error, 1)
+		close(out)
+		errc <- err
+		close(errc)
+		return out, errc
+	}
+	chunks, errc := ReadRecordChunks(ctx, f, size, delim)
+	out := make(chan Chunk)
+	go func() {
+		defer close(out)
+		defer f.Close()
+		for c := range chunks {
+			if !send(ctx, out, c) {
+				return
+			}
+		}
+	}()
+	return out, errc
+}
+
+func readChunks(ctx context.Context, r io.Reader, size int, delim *byte) (<-chan Chunk, <-chan error) {
+	size = max(size, 1)
+	out := make(chan Chunk)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errc)
+		br := bufio.NewReaderSize(r, size)
+		var offset int64
+		for {
+			data := make([]byte, size) // a new buffer for every chunk, the previous one belongs to a worker
+			n, err := io.ReadFull(br, data)
+			data = data[:n]
+			if err == nil && delim != nil && data[n-1] != *delim {
+				var rest []byte
+				rest, err = br.ReadBytes(*delim)
+				data = append(data, rest...)
+			}
+			if len(data) > 0 {
+				if !send(ctx, out, Chunk{Offset: offset, Data: data}) {
+					return
+				}
+				offset += int64(len(data))
+			}
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	return out, errc
+}
@@ -0,0 +1,147 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline/pipelinetest"
+)
+
+// writeLines writes a file with the numbers from 0 to n-1, one per line
+func writeLines(t *testing.T, n int) (path string, content []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	for i := range n {
+		fmt.Fprintln(&buf, i)
+	}
+	path = filepath.Join(t.TempDir(), "in.txt")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path, buf.Bytes()
+}
+
+func TestReadChunks(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	data := []byte("abcdefghij")
+	chunks, errc := pipeline.ReadChunks(context.Background(), bytes.NewReader(data), 4)
+
+	var got []string
+	var offset int64
+	for c := range chunks {
+		if c.Offset != offset {
+			t.Errorf("chunk %q: got offset %d, want %d", c.Data, c.Offset, offset)
+		}
+		offset += int64(len(c.Data))
+		got = append(got, string(c.Data))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"abcd", "efgh", "ij"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got chunks %q, want %q", got, want)
+	}
+}
+
+func TestReadFileKeepsRecordsWhole(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	path, content := writeLines(t, 1000)
+	chunks, errc := pipeline.ReadFile(context.Background(), path, 100, '\n')
+
+	var all []byte
+	n := 0
+	for c := range chunks {
+		n++
+		if len(c.Data) < 100 && int(c.Offset)+len(c.Data) != len(content) {
+			t.Errorf("chunk at %d is %d bytes and is not the last one", c.Offset, len(c.Data))
+		}
+		if c.Data[len(c.Data)-1] != '\n' {
+			t.Errorf("chunk at %d splits a record: %q", c.Offset, c.Data[len(c.Data)-10:])
+		}
+		all = append(all, c.Data...)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(all, content) {
+		t.Error("the chunks don't add up to the file")
+	}
+	if n < 2 {
+		t.Errorf("got %d chunks, want the file split", n)
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	chunks, errc := pipeline.ReadFile(context.Background(), filepath.Join(t.TempDir(), "missing"), 100, '\n')
+	for range chunks {
+		t.Error("got a chunk from a missing file")
+	}
+	if err := <-errc; !os.IsNotExist(err) {
+		t.Errorf("got error %v, want a missing file", err)
+	}
+}
+
+// TestFilePipeline reads a file, parses and doubles every number in parallel workers and writes the result to another file
+func TestFilePipeline(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	ctx := context.Background()
+	path, _ := writeLines(t, 5000)
+
+	chunks, errc := pipeline.ReadFile(ctx, path, 512, '\n')
+	type result struct {
+		out []byte
+		err error
+	}
+	results := pipeline.MapConcurrent(ctx, chunks, 4, func(c pipeline.Chunk) result {
+		var out bytes.Buffer
+		for _, line := range strings.Fields(string(c.Data)) {
+			n, err := strconv.Atoi(line)
+			if err != nil {
+				return result{err: err}
+			}
+			fmt.Fprintln(&out, 2*n)
+		}
+		return result{out: out.Bytes()}
+	})
+
+	outPath := filepath.Join(t.TempDir(), "out.txt")
+	f, err := os.Create(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for r := range results {
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if _, err := f.Write(r.out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(string(got))
+	if len(lines) != 5000 {
+		t.Fatalf("got %d lines, want 5000", len(lines))
+	}
+	for i, line := range lines {
+		if line != strconv.Itoa(2*i) {
+			t.Fatalf("line %d: got %s, want %d", i, line, 2*i)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/async"
+)
+
+// RunAsync runs the pipeline in a new goroutine and returns its future, use Shutdown or the context to stop it.
+// Without a sink the values that reach the end of the pipeline are the result of the future,
+// with a sink they go to the sink and the result is empty.
+func (p *Pipeline[T]) RunAsync(ctx context.Context) *async.Future[[]T] {
+	return async.Go(ctx, func(ctx context.Context) ([]T, error) {
+		if p.sink != nil {
+			return nil, p.Run(ctx)
+		}
+		var res []T
+		err := p.execute(ctx, func(_ context.Context, v T) error {
+			res = append(res, v)
+			return nil
+		}, nil)
+		return res, err
+	})
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VISUALIZATION
+// A pipeline built in code is hard to picture once it has a dozen stages with different options.
+// Graph describes it in the DOT language (Graphviz): a node per stage with its workers and its buffer,
+// and while the pipeline runs, how full the queue of every stage is. A full queue is the stage downstream
+// not keeping up, the bottleneck is usually right after the last full queue.
+// e.g. go run . | dot -Tsvg > pipeline.svg
+
+// Graph returns the topology of the pipeline in DOT format, with the queue depths if it's running
+func (p *Pipeline[T]) Graph() string {
+	p.mu.Lock()
+	r := p.current
+	p.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("digraph pipeline {\n")
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box];\n")
+	b.WriteString("\tsource [shape=oval];\n")
+
+	prev := "source"
+	for _, s := range p.stages {
+		name := s.opts.name
+		label := []string{name, fmt.Sprintf("workers: %d", s.opts.concurrency)}
+		switch {
+		case p.batching != nil:
+			label = append(label, fmt.Sprintf("batches: %d x %d", s.opts.buffer, p.batching.size))
+		case s.opts.lockFree:
+			label = append(label, fmt.Sprintf("lock-free queue: %d", s.opts.buffer))
+		default:
+			label = append(label, fmt.Sprintf("buffer: %d", s.opts.buffer))
+		}
+		if r != nil {
+			if length, capacity, ok := r.depth(name); ok {
+				label = append(label, fmt.Sprintf("queue: %d/%d", length, capacity))
+			}
+		}
+		fmt.Fprintf(&b, "\t%s [label=%s];\n", dotQuote(name), dotQuote(strings.Join(label, "\n")))
+		fmt.Fprintf(&b, "\t%s -> %s;\n", dotQuote(prev), dotQuote(name))
+		prev = name
+	}
+
+	b.WriteString("\tsink [shape=oval];\n")
+	fmt.Fprintf(&b, "\t%s -> sink;\n", dotQuote(prev))
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote quotes a DOT identifier, new lines become line breaks of the label
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
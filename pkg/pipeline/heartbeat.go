@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+)
+
+// HEARTBEATS
+// A goroutine that is stuck (a deadlock, a call without timeout) looks exactly like a goroutine
+// waiting for work: its channels are quiet. A heartbeat tells them apart: the stage pulses after
+// every value and every interval while it's idle, a stage that stops pulsing is stalled.
+// The pulses are sent without blocking, nobody listening must never slow down the stage.
+
+// ErrStalled is returned by Supervisor.Watch when a stage stops pulsing and the policy doesn't restart it
+var ErrStalled = errors.New("pipeline: stage stalled")
+
+// Heartbeat applies fn to every value received from in and pulses on the second channel
+// after every value and once per interval while waiting, it accepts WithClock
+func Heartbeat[In, Out any](ctx context.Context, in <-chan In, interval time.Duration, fn func(context.Context, In) Out, opts ...Option) (<-chan Out, <-chan struct{}) {
+	o := newStageOptions(opts)
+	out := make(chan Out)
+	beat := make(chan struct{}, 1)
+	pulse := func() {
+		select {
+		case beat <- struct{}{}:
+		default: // a pulse is already waiting, nobody is listening
+		}
+	}
+
+	go func() {
+		defer close(out)
+		defer close(beat)
+		ticker := o.clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				res := fn(ctx, v)
+				pulse()
+				// waiting for downstream is not being stuck, keep pulsing
+				for sent := false; !sent; {
+					select {
+					case out <- res:
+						sent = true
+					case <-ticker.C():
+						pulse()
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ticker.C():
+				pulse()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, beat
+}
+
+// StallPolicy decides what a supervisor does with a stalled stage
+type StallPolicy int
+
+const (
+	// CancelStalled cancels the stage and stops watching it
+	CancelStalled StallPolicy = iota
+	// RestartStalled cancels the stage and starts it again
+	RestartStalled
+)
+
+// Supervisor watches the heartbeat of a stage and acts when no pulse arrives within Timeout
+type Supervisor struct {
+	Timeout time.Duration
+	Policy  StallPolicy
+	OnStall func(name string) // called before the policy is applied, can be nil
+	Clock   clock.Clock       // clock.Real if not set
+}
+
+// Watch starts the stage with a context of its own and watches the heartbeat returned by start,
+// it blocks until the heartbeat is closed (the stage is done), the context is done
+// or the stage stalls and the policy is CancelStalled, in which case it returns ErrStalled
+func (s Supervisor) Watch(ctx context.Context, name string, start func(ctx context.Context) <-chan struct{}) error {
+	c := s.Clock
+	if c == nil {
+		c = clock.Real
+	}
+	for {
+		stageCtx, cancel := context.WithCancel(ctx)
+		stalled := s.watch(stageCtx, c, start(stageCtx))
+		cancel()
+		if !stalled {
+			return ctx.Err()
+		}
+		if s.OnStall != nil {
+			s.OnStall(name)
+		}
+		if s.Policy != RestartStalled {
+			return fmt.Errorf("%w: %s", ErrStalled, name)
+		}
+	}
+}
+
+// watch reports whether the heartbeat missed the timeout, it returns false once the heartbeat is closed
+func (s Supervisor) watch(ctx context.Context, c clock.Clock, beat <-chan struct{}) bool {
+	timer := c.NewTimer(s.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-beat:
+			if !ok {
+				return false
+			}
+			stopTimer(timer)
+			timer.Reset(s.Timeout)
+		case <-timer.C():
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
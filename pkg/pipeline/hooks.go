@@ -0,0 +1,65 @@
+package pipeline
+
+import "context"
+
+// LIFECYCLE HOOKS
+// Logging the start of a pipeline, flushing a buffer when a stage is done or alerting when it fails
+// are application concerns, not stage logic. Hooks are called by the builder at those points,
+// they run in the goroutine that reached the point so they must be quick and must not block.
+
+// hooks holds the callbacks registered on the builder, every one of them can be nil
+type hooks struct {
+	start      func(ctx context.Context)
+	stageError func(stage string, err error)
+	stageExit  func(stage string)
+	stop       func(err error)
+}
+
+// OnStart registers a function called when Run starts, before the source is read
+func (p *Pipeline[T]) OnStart(fn func(ctx context.Context)) *Pipeline[T] {
+	p.hooks.start = fn
+	return p
+}
+
+// OnStageError registers a function called every time a stage or the sink ("sink") returns an error,
+// including the errors the pipeline survives (recovered panics with the Continue policy)
+func (p *Pipeline[T]) OnStageError(fn func(stage string, err error)) *Pipeline[T] {
+	p.hooks.stageError = fn
+	return p
+}
+
+// OnStageExit registers a function called when every goroutine of a stage has exited
+func (p *Pipeline[T]) OnStageExit(fn func(stage string)) *Pipeline[T] {
+	p.hooks.stageExit = fn
+	return p
+}
+
+// OnStop registers a function called when Run is about to return, with the error it returns
+func (p *Pipeline[T]) OnStop(fn func(err error)) *Pipeline[T] {
+	p.hooks.stop = fn
+	return p
+}
+
+func (h *hooks) onStart(ctx context.Context) {
+	if h.start != nil {
+		h.start(ctx)
+	}
+}
+
+func (h *hooks) onStageError(stage string, err error) {
+	if h.stageError != nil {
+		h.stageError(stage, err)
+	}
+}
+
+func (h *hooks) onStageExit(stage string) {
+	if h.stageExit != nil {
+		h.stageExit(stage)
+	}
+}
+
+func (h *hooks) onStop(err error) {
+	if h.stop != nil {
+		h.stop(err)
+	}
+}
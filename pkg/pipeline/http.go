@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTP
+// A pipeline built for a single request must not outlive it: running it with r.Context()
+// means a client that disconnects cancels every stage goroutine. The response is the sink:
+// every value is written and flushed right away (chunked encoding or server-sent events),
+// so the client sees the results while the pipeline is still running.
+
+// Handler returns an http.Handler that builds a pipeline for every request with build and runs it
+// with the request context, the values are written to the response by the sink returned by sink,
+// a build error is answered with 400 and a pipeline error with 500 if nothing was written yet
+func Handler[T any](build func(r *http.Request) (*Pipeline[T], error), sink func(w http.ResponseWriter) SinkFunc[T]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := build(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rw := &responseWriter{ResponseWriter: w}
+		err = p.Sink(sink(rw)).Run(r.Context())
+		if err == nil || errors.Is(err, context.Canceled) || rw.written {
+			return // done, the client is gone or the status is already sent
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	})
+}
+
+// responseWriter remembers whether the response has started
+type responseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ChunkedSink writes every value encoded by encode to the response and flushes it
+func ChunkedSink[T any](w http.ResponseWriter, encode func(T) ([]byte, error)) SinkFunc[T] {
+	rc := http.NewResponseController(w)
+	return func(ctx context.Context, v T) error {
+		b, err := encode(v)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+}
+
+// SSESink writes every value encoded by encode to the response as a server-sent event and flushes it,
+// the encoded value must not contain new lines
+func SSESink[T any](w http.ResponseWriter, encode func(T) ([]byte, error)) SinkFunc[T] {
+	rc := http.NewResponseController(w)
+	started := false
+	return func(ctx context.Context, v T) error {
+		b, err := encode(v)
+		if err != nil {
+			return err
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			started = true
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+}
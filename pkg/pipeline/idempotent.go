@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/cache"
+)
+
+// EXACTLY-ONCE SINK
+// At-least-once delivery (AtLeastOnce, checkpoints) sends a value again when it's not sure it was processed,
+// so a sink with side effects (charging a card, sending an email) would repeat them.
+// Every value carries an idempotency key: the sink skips the keys already committed to a store
+// and commits the key after its side effect. Two deliveries of the same key at the same time are serialized,
+// the second one sees the commit of the first. A crash between the side effect and the commit can still
+// repeat it, a store that commits in the same transaction as the side effect closes that gap.
+
+// IdempotencyStore remembers the keys of the values already processed
+type IdempotencyStore interface {
+	// Seen reports whether the key has been committed
+	Seen(ctx context.Context, key string) (bool, error)
+	// Commit records the key as processed
+	Commit(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyStore keeps the keys in memory for a while, it doesn't survive a process restart
+type MemoryIdempotencyStore struct {
+	keys *cache.Cache[string, struct{}]
+}
+
+// NewMemoryIdempotencyStore creates a store that forgets the keys after ttl, zero keeps them forever
+// (redeliveries usually happen within minutes, keeping every key forever only grows the memory)
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{keys: cache.New[string, struct{}](ttl)}
+}
+
+// Seen implements IdempotencyStore
+func (m *MemoryIdempotencyStore) Seen(_ context.Context, key string) (bool, error) {
+	_, ok := m.keys.Get(key)
+	return ok, nil
+}
+
+// Commit implements IdempotencyStore
+func (m *MemoryIdempotencyStore) Commit(_ context.Context, key string) error {
+	m.keys.Set(key, struct{}{})
+	return nil
+}
+
+// ExactlyOnce wraps the sink so it's called once per idempotency key, the values whose key
+// was already committed to the store are skipped, a failed sink doesn't commit the key so it can be retried
+func ExactlyOnce[T any](store IdempotencyStore, key func(T) string, sink SinkFunc[T]) SinkFunc[T] {
+	var mu sync.Mutex
+	inFlight := make(map[string]chan struct{}) // closed when the delivery of the key is over
+
+	return func(ctx context.Context, v T) error {
+		k := key(v)
+		// wait for a delivery of the same key in progress
+		for {
+			mu.Lock()
+			done, busy := inFlight[k]
+			if !busy {
+				inFlight[k] = make(chan struct{})
+				mu.Unlock()
+				break
+			}
+			mu.Unlock()
+			select {
+			case <-done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer func() {
+			mu.Lock()
+			close(inFlight[k])
+			delete(inFlight, k)
+			mu.Unlock()
+		}()
+
+		seen, err := store.Seen(ctx, k)
+		if err != nil {
+			return fmt.Errorf("pipeline: idempotency store: %w", err)
+		}
+		if seen {
+			return nil // already processed
+		}
+		if err := sink(ctx, v); err != nil {
+			return err
+		}
+		if err := store.Commit(ctx, k); err != nil {
+			return fmt.Errorf("pipeline: idempotency store: %w", err)
+		}
+		return nil
+	}
+}
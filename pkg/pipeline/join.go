@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// STREAM JOIN
+// Every stage so far reads a single channel. Correlating two streams (an order with its payment,
+// a request with its response) needs a stage that reads both: every value waits in a buffer for
+// its counterpart from the other side, values older than the window are forgotten so the buffers
+// don't grow forever. A value matches every value of the other side with the same key within the window.
+
+// Joined is a pair of values with the same key coming from the two sides of a join
+type Joined[L, R any] struct {
+	Left  L
+	Right R
+}
+
+// Join sends a pair for every left and right values with the same key received within the window of each other,
+// it returns when both inputs are closed, it accepts WithClock
+func Join[L, R any, K comparable](ctx context.Context, left <-chan L, right <-chan R, leftKey func(L) K, rightKey func(R) K, window time.Duration, opts ...Option) <-chan Joined[L, R] {
+	o := newStageOptions(opts)
+	out := make(chan Joined[L, R])
+	go func() {
+		defer close(out)
+		lefts := newJoinBuffer[K, L]()
+		rights := newJoinBuffer[K, R]()
+
+		for left != nil || right != nil {
+			select {
+			case l, ok := <-left:
+				if !ok {
+					left = nil
+					continue
+				}
+				now := o.clock.Now()
+				lefts.expire(now, window)
+				rights.expire(now, window)
+				k := leftKey(l)
+				for _, r := range rights.values[k] {
+					if !send(ctx, out, Joined[L, R]{Left: l, Right: r.v}) {
+						return
+					}
+				}
+				lefts.add(k, l, now)
+			case r, ok := <-right:
+				if !ok {
+					right = nil
+					continue
+				}
+				now := o.clock.Now()
+				lefts.expire(now, window)
+				rights.expire(now, window)
+				k := rightKey(r)
+				for _, l := range lefts.values[k] {
+					if !send(ctx, out, Joined[L, R]{Left: l.v, Right: r}) {
+						return
+					}
+				}
+				rights.add(k, r, now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// joinBuffer holds the values of one side of a join waiting for their counterpart
+type joinBuffer[K comparable, T any] struct {
+	values map[K][]timed[T] // by key, oldest first
+	order  []timed[K]       // keys in arrival order, to expire the oldest values first
+}
+
+func newJoinBuffer[K comparable, T any]() *joinBuffer[K, T] {
+	return &joinBuffer[K, T]{values: make(map[K][]timed[T])}
+}
+
+func (b *joinBuffer[K, T]) add(k K, v T, now time.Time) {
+	b.values[k] = append(b.values[k], timed[T]{at: now, v: v})
+	b.order = append(b.order, timed[K]{at: now, v: k})
+}
+
+// expire forgets the values older than the window
+func (b *joinBuffer[K, T]) expire(now time.Time, window time.Duration) {
+	n := 0
+	for ; n < len(b.order) && now.Sub(b.order[n].at) > window; n++ {
+		k := b.order[n].v
+		if vs := b.values[k][1:]; len(vs) > 0 {
+			b.values[k] = vs
+		} else {
+			delete(b.values, k)
+		}
+	}
+	b.order = b.order[n:]
+}
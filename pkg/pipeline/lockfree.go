@@ -0,0 +1,34 @@
+package pipeline
+
+import "github.com/alejandro-curci/golang-talk-concurrency/pkg/mpsc"
+
+// LOCK-FREE TRANSPORT
+// The workers of a stage are many producers and the next stage (with a single goroutine) is one consumer,
+// exactly the case of the mpsc queue. On a hot path it saves the lock of the channel on every value.
+// A queue can't be used in a select, so this is internal to the builder: the stages don't see the difference.
+
+// runLockFreeStage is runStage sending the results through an mpsc queue
+func (p *Pipeline[T]) runLockFreeStage(r *run, w *worker[T], in receiver[T]) receiver[T] {
+	q := mpsc.New[T](max(w.opts.buffer, 1))
+	r.track(w.name, func() (int, int) { return q.Len(), q.Cap() })
+	p.startWorkers(r, w, func() {
+		for v, ok := in(); ok; v, ok = in() {
+			res, keep, stop := w.process(v)
+			if stop {
+				return
+			}
+			if !keep {
+				continue
+			}
+			if !q.Push(r.ctx, res) {
+				return
+			}
+			if p.metrics != nil {
+				p.metrics.QueueDepth(w.name, q.Len(), q.Cap())
+			}
+		}
+	}, q.Close)
+	return func() (T, bool) {
+		return q.Pop(r.ctx)
+	}
+}
@@ -0,0 +1,27 @@
+package pipeline
+
+import "log/slog"
+
+// STRUCTURED LOGGING
+// "stage 2 failed" means nothing when a service runs ten pipelines. With a logger the builder reports
+// what happens in the pipeline (start, every stage starting and stopping, every failed value and how many
+// stages are still draining during a shutdown) as structured records carrying the pipeline id and the stage name,
+// so they can be filtered like any other log.
+
+// Log makes the pipeline log its lifecycle and the failed values through the logger,
+// the records have a "pipeline" attribute (if the pipeline has an ID) and a "stage" attribute
+func (p *Pipeline[T]) Log(logger *slog.Logger) *Pipeline[T] {
+	p.logger = logger
+	return p
+}
+
+// runLogger returns the logger of a single Run, nil if the pipeline doesn't log
+func (p *Pipeline[T]) runLogger(id string) *slog.Logger {
+	if p.logger == nil {
+		return nil
+	}
+	if id == "" {
+		return p.logger
+	}
+	return p.logger.With("pipeline", id)
+}
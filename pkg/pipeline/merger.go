@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DYNAMIC MERGE
+// merge gets every input up front and closes its output when all of them are closed.
+// When inputs come and go (workers scaling up and down, subscribers joining) the fan-in has to
+// accept new channels while it's running, so it can't decide on its own when it's over:
+// the output is closed only after Close is called and every remaining input is done.
+
+// ErrMergerClosed is returned by Add after Close
+var ErrMergerClosed = errors.New("pipeline: merger closed")
+
+// Merger is a fan-in whose inputs can be added and removed while it's running
+type Merger[T any] struct {
+	ctx context.Context
+	out chan T
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex
+	inputs map[<-chan T]chan struct{} // input -> closed to stop forwarding it
+	closed bool
+}
+
+// NewMerger creates a merger without inputs
+func NewMerger[T any](ctx context.Context) *Merger[T] {
+	return &Merger[T]{ctx: ctx, out: make(chan T), inputs: make(map[<-chan T]chan struct{})}
+}
+
+// Out returns the channel where the values of every input are sent
+func (m *Merger[T]) Out() <-chan T {
+	return m.out
+}
+
+// Add starts forwarding the values of the channel, adding the same channel twice does nothing
+func (m *Merger[T]) Add(ch <-chan T) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrMergerClosed
+	}
+	if _, ok := m.inputs[ch]; ok {
+		return nil
+	}
+	stop := make(chan struct{})
+	m.inputs[ch] = stop
+	m.wg.Add(1)
+	go m.forward(ch, stop)
+	return nil
+}
+
+// Remove stops forwarding the values of the channel, the values not read yet stay in the channel
+func (m *Merger[T]) Remove(ch <-chan T) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stop, ok := m.inputs[ch]; ok {
+		close(stop)
+		delete(m.inputs, ch)
+	}
+}
+
+// Len returns the number of inputs being forwarded
+func (m *Merger[T]) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.inputs)
+}
+
+// Close tells the merger no more inputs will be added,
+// the output is closed once the remaining inputs are closed or removed
+func (m *Merger[T]) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	go func() {
+		m.wg.Wait()
+		close(m.out)
+	}()
+}
+
+func (m *Merger[T]) forward(ch <-chan T, stop <-chan struct{}) {
+	defer m.wg.Done()
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				m.Remove(ch)
+				return
+			}
+			// the value was already taken from the input, deliver it even if it's being removed
+			if !send(m.ctx, m.out, v) {
+				return
+			}
+		case <-stop:
+			return
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// METRICS
+// Without numbers it's impossible to tell which stage is the bottleneck.
+// A slow stage shows a high latency, and the stage right before it shows a full output queue.
+
+// Metrics receives the measurements taken by the pipeline for every stage
+type Metrics interface {
+	// ItemProcessed is called after the stage function returns for a value
+	ItemProcessed(stage string, latency time.Duration)
+	// QueueDepth is called with the occupancy of the output channel after every send
+	QueueDepth(stage string, depth, capacity int)
+	// ItemDropped is called when the overflow policy of the stage discards a value
+	ItemDropped(stage string)
+}
+
+// Metrics sets where the pipeline reports its measurements
+func (p *Pipeline[T]) Metrics(m Metrics) *Pipeline[T] {
+	p.metrics = m
+	return p
+}
+
+// StageStats are the numbers collected for a single stage
+type StageStats struct {
+	Processed    int64
+	Dropped      int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+	Depth        int
+	MaxDepth     int
+	Capacity     int
+}
+
+// AvgLatency returns the mean time spent processing a value
+func (s StageStats) AvgLatency() time.Duration {
+	if s.Processed == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Processed)
+}
+
+// Collector is an in-memory Metrics implementation
+type Collector struct {
+	mu     sync.Mutex
+	stages map[string]*StageStats
+}
+
+// NewCollector creates an empty collector
+func NewCollector() *Collector {
+	return &Collector{stages: make(map[string]*StageStats)}
+}
+
+// ItemProcessed implements Metrics
+func (c *Collector) ItemProcessed(stage string, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(stage)
+	s.Processed++
+	s.TotalLatency += latency
+	s.MaxLatency = max(s.MaxLatency, latency)
+}
+
+// QueueDepth implements Metrics
+func (c *Collector) QueueDepth(stage string, depth, capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(stage)
+	s.Depth, s.Capacity = depth, capacity
+	s.MaxDepth = max(s.MaxDepth, depth)
+}
+
+// ItemDropped implements Metrics
+func (c *Collector) ItemDropped(stage string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(stage).Dropped++
+}
+
+func (c *Collector) get(stage string) *StageStats {
+	s, ok := c.stages[stage]
+	if !ok {
+		s = &StageStats{}
+		c.stages[stage] = s
+	}
+	return s
+}
+
+// Snapshot returns a copy of the numbers collected so far, by stage name
+func (c *Collector) Snapshot() map[string]StageStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap := make(map[string]StageStats, len(c.stages))
+	for name, s := range c.stages {
+		snap[name] = *s
+	}
+	return snap
+}
+
+// Publish exposes the snapshot through expvar (/debug/vars) under the given name
+func (c *Collector) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return c.Snapshot()
+	}))
+}
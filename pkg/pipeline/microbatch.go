@@ -0,0 +1,151 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// MICRO-BATCHING
+// A channel send costs around a hundred nanoseconds (a lock, maybe a goroutine switch), when a stage does
+// less work than that per value the pipeline spends most of its time moving values around.
+// With micro-batching the stages of the builder exchange slices of values instead of single values:
+// one send per batch instead of one per value. The stage functions still receive one value at a time,
+// only the transport changes. A batch is sent when it's full or when maxDelay has passed since its first value.
+
+// batching is the micro-batching configuration of a pipeline
+type batching struct {
+	size     int
+	maxDelay time.Duration
+}
+
+// MicroBatch makes the stages exchange batches of up to size values, a partial batch is sent after maxDelay
+// (a zero maxDelay means batches are only sent when full or when the input is closed, like Batch),
+// the overflow policies are ignored
+func (p *Pipeline[T]) MicroBatch(size int, maxDelay time.Duration) *Pipeline[T] {
+	if size <= 1 {
+		p.batching = nil // one by one
+		return p
+	}
+	p.batching = &batching{size: size, maxDelay: max(maxDelay, 0)}
+	return p
+}
+
+// batchSource groups the values of the source into batches, the partial batch is flushed when the source is closed
+func batchSource[T any](ctx context.Context, in <-chan T, cfg batching) <-chan []T {
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		b := newBatcher(ctx, out, cfg)
+		defer b.stop()
+		for {
+			v, ok := receive(ctx, in, b)
+			if !ok {
+				b.flush()
+				return
+			}
+			if !b.add(v) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// runBatchedStage is runStage for a pipeline exchanging batches
+func (p *Pipeline[T]) runBatchedStage(r *run, i int, in <-chan []T) <-chan []T {
+	w := p.newWorker(r, i)
+	out := make(chan []T, w.opts.buffer)
+	r.track(w.name, func() (int, int) { return len(out), cap(out) }) // in batches
+	p.startWorkers(r, w, func() {
+		b := newBatcher(r.ctx, out, *p.batching)
+		defer b.stop()
+		for {
+			vs, ok := receive(r.ctx, in, b)
+			if !ok {
+				b.flush()
+				return
+			}
+			for _, v := range vs {
+				res, keep, stop := w.process(v)
+				if stop {
+					return
+				}
+				if keep && !b.add(res) {
+					return
+				}
+			}
+			if p.metrics != nil {
+				p.metrics.QueueDepth(w.name, len(out), cap(out))
+			}
+		}
+	}, func() {
+		close(out)
+	})
+	return out
+}
+
+// batcher accumulates the values of a goroutine and sends them in batches
+type batcher[T any] struct {
+	ctx   context.Context
+	out   chan<- []T
+	cfg   batching
+	batch []T
+
+	timer   *time.Timer
+	timeout <-chan time.Time // nil while the batch is empty
+}
+
+func newBatcher[T any](ctx context.Context, out chan<- []T, cfg batching) *batcher[T] {
+	return &batcher[T]{ctx: ctx, out: out, cfg: cfg, batch: make([]T, 0, cfg.size)}
+}
+
+// add appends a value to the batch and sends the batch if it's full, it returns false if the context is done
+func (b *batcher[T]) add(v T) bool {
+	b.batch = append(b.batch, v)
+	if len(b.batch) == b.cfg.size {
+		return b.flush()
+	}
+	if len(b.batch) == 1 && b.cfg.maxDelay > 0 {
+		b.timer = time.NewTimer(b.cfg.maxDelay)
+		b.timeout = b.timer.C
+	}
+	return true
+}
+
+// flush sends the partial batch, it returns false if the context is done
+func (b *batcher[T]) flush() bool {
+	b.stop()
+	if len(b.batch) == 0 {
+		return true
+	}
+	if !send(b.ctx, b.out, b.batch) {
+		return false
+	}
+	b.batch = make([]T, 0, b.cfg.size) // the one sent belongs to the next stage now
+	return true
+}
+
+func (b *batcher[T]) stop() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer, b.timeout = nil, nil
+	}
+}
+
+// receive waits for the next input of a batching goroutine, sending the partial batch when it's time,
+// it returns false when the input is closed or the context is done
+func receive[E, T any](ctx context.Context, in <-chan E, b *batcher[T]) (E, bool) {
+	var zero E
+	for {
+		select {
+		case e, ok := <-in:
+			return e, ok
+		case <-b.timeout:
+			if !b.flush() {
+				return zero, false
+			}
+		case <-ctx.Done():
+			return zero, false
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/circuitbreaker"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/ratelimit"
+)
+
+// MIDDLEWARE
+// Logging, metrics, retries or panic recovery have nothing to do with what a stage does,
+// so they shouldn't be written inside every stage function. A middleware wraps a stage function
+// with another one (the same idea as net/http middleware) and the builder applies it to every stage.
+
+// Middleware wraps a stage function, it usually calls next at some point
+type Middleware[T any] func(next StageFunc[T]) StageFunc[T]
+
+// Use adds middleware applied to every stage, the first one added is the outermost
+func (p *Pipeline[T]) Use(mw ...Middleware[T]) *Pipeline[T] {
+	p.middleware = append(p.middleware, mw...)
+	return p
+}
+
+// chain wraps fn with the middleware, mw[0] ends up being the outermost
+func chain[T any](fn StageFunc[T], mw []Middleware[T]) StageFunc[T] {
+	for i := len(mw) - 1; i >= 0; i-- {
+		fn = mw[i](fn)
+	}
+	return fn
+}
+
+// Retrying is a middleware that retries the stage function according to the policy
+func Retrying[T any](policy RetryPolicy) Middleware[T] {
+	return func(next StageFunc[T]) StageFunc[T] {
+		return func(ctx context.Context, v T) (T, error) {
+			res, _, err := retry(ctx, policy, func(ctx context.Context) (T, error) {
+				return next(ctx, v)
+			})
+			return res, err
+		}
+	}
+}
+
+// RateLimited is a middleware that waits for the limiter before calling the stage function,
+// the same limiter can be shared by several stages or pipelines
+func RateLimited[T any](l ratelimit.Limiter) Middleware[T] {
+	return func(next StageFunc[T]) StageFunc[T] {
+		return func(ctx context.Context, v T) (T, error) {
+			if err := l.Wait(ctx); err != nil {
+				var zero T
+				return zero, err
+			}
+			return next(ctx, v)
+		}
+	}
+}
+
+// Breaking is a middleware that calls the stage function through the breaker,
+// while the breaker is open the values fail right away with circuitbreaker.ErrOpen
+func Breaking[T any](b *circuitbreaker.Breaker) Middleware[T] {
+	return func(next StageFunc[T]) StageFunc[T] {
+		return func(ctx context.Context, v T) (T, error) {
+			return circuitbreaker.Call(ctx, b, func(ctx context.Context) (T, error) {
+				return next(ctx, v)
+			})
+		}
+	}
+}
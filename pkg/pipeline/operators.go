@@ -0,0 +1,124 @@
+package pipeline
+
+import "context"
+
+// OPERATORS
+// Most stages are one of three shapes: transform every value (power), keep some of them,
+// or fold them into a single result (sum). These operators implement the goroutine loop once.
+
+// Map sends fn(v) downstream for every value received from in
+func Map[T, U any](ctx context.Context, in <-chan T, fn func(T) U) <-chan U {
+	return Lift(fn)(ctx, in)
+}
+
+// MapConcurrent is Map with up to n calls to fn running at the same time,
+// the results are still sent in the order the values were received
+func MapConcurrent[T, U any](ctx context.Context, in <-chan T, n int, fn func(T) U) <-chan U {
+	if n < 1 {
+		n = 1
+	}
+	out := make(chan U)
+	sem := make(chan struct{}, n)
+	// one result channel per value, queued in input order: the fan-out writes them,
+	// the fan-in reads them one after the other so a fast value waits for the slow ones before it
+	results := make(chan chan U, n)
+
+	go func() {
+		defer close(results)
+		for v := range OrDone(ctx, in) {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			res := make(chan U, 1) // buffered, the worker never blocks if nobody reads it
+			select {
+			case results <- res:
+			case <-ctx.Done():
+				<-sem
+				return
+			}
+			go func() {
+				defer func() { <-sem }()
+				res <- fn(v)
+			}()
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for res := range results {
+			var v U
+			select {
+			case v = <-res:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Filter only sends downstream the values for which keep returns true
+func Filter[T any](ctx context.Context, in <-chan T, keep func(T) bool) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for v := range in {
+			if !keep(v) {
+				continue
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Reduce folds every value received from in into an accumulator starting at init,
+// the result is sent once the input is closed
+func Reduce[T, A any](ctx context.Context, in <-chan T, init A, fn func(A, T) A) <-chan A {
+	out := make(chan A)
+	go func() {
+		defer close(out)
+		acc := init
+		for v := range OrDone(ctx, in) {
+			acc = fn(acc, v)
+		}
+		if ctx.Err() != nil {
+			return // cancelled, the result is incomplete
+		}
+		select {
+		case out <- acc:
+		case <-ctx.Done():
+		}
+	}()
+	return out
+}
+
+// PARALLEL REDUCE
+// sum folds the whole stream in a single goroutine, which becomes the bottleneck when fn is expensive.
+// If the combine function is associative, the stream can be fanned out to n workers that fold their share
+// into partial results, and a final step combines the partials into the total.
+
+// ParallelReduce folds the values received from in with n workers, each one starting at init,
+// then merges their partial results with combine, init must be the identity of combine
+// (0 for a sum, 1 for a product...) because it's folded once per worker
+func ParallelReduce[T, A any](ctx context.Context, in <-chan T, n int, init A, fn func(A, T) A, combine func(A, A) A) <-chan A {
+	if n < 1 {
+		n = 1
+	}
+	partials := make([]<-chan A, n)
+	for i := range partials {
+		partials[i] = Reduce(ctx, in, init, fn)
+	}
+	return Reduce(ctx, Merge(ctx, partials...), init, combine)
+}
@@ -0,0 +1,55 @@
+package pipeline_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline/pipelinetest"
+)
+
+func TestMapConcurrentKeepsOrder(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	ctx := context.Background()
+	values := make([]int, 50)
+	for i := range values {
+		values[i] = i
+	}
+
+	var running, peak atomic.Int64
+	out := pipeline.MapConcurrent(ctx, pipeline.Generate(ctx, values...), 4, func(v int) int {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		// the first values are the slowest, they finish after the ones received later
+		time.Sleep(time.Duration(len(values)-v) * 100 * time.Microsecond)
+		return v * 2
+	})
+
+	i := 0
+	for v := range out {
+		if v != i*2 {
+			t.Fatalf("value %d: got %d, want %d", i, v, i*2)
+		}
+		i++
+	}
+	if i != len(values) {
+		t.Errorf("got %d values, want %d", i, len(values))
+	}
+	if p := peak.Load(); p > 4 || p < 2 {
+		t.Errorf("%d calls ran at the same time, want between 2 and 4", p)
+	}
+}
+
+func TestMapConcurrentStopsOnCancel(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := pipeline.MapConcurrent(ctx, pipeline.Repeat(ctx, 1), 3, func(v int) int { return v })
+	<-out
+	cancel()
+	for range out {
+	}
+}
@@ -0,0 +1,113 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/bulkhead"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+)
+
+// BUFFERING
+// Unbuffered channels make every send wait for the receiver.
+// A buffer lets a fast stage keep working while a slower one catches up,
+// trading memory for throughput, the right size depends on the pipeline so it's configurable per stage.
+
+// DefaultBuffer is the capacity of the channel of a side output when WithBuffer is not used
+const DefaultBuffer = 32
+
+// Option configures a single stage of the pipeline
+type Option func(*stageOptions)
+
+type stageOptions struct {
+	name     string
+	buffer   int
+	overflow Overflow
+	clock    clock.Clock
+	bulkhead *bulkhead.Bulkhead
+
+	concurrency int
+	maxKeys     int
+	lockFree    bool
+	quarantine  *quarantine
+	interval    time.Duration
+}
+
+// Overflow decides what a stage does with a value when the consumer is not ready for it
+type Overflow int
+
+const (
+	// Block waits for the consumer, the default
+	Block Overflow = iota
+	// DropNewest discards the value that doesn't fit
+	DropNewest
+	// DropOldest discards the oldest value waiting in the buffer to make room for the new one
+	DropOldest
+)
+
+// WithName names the stage in errors, metrics, traces, hooks and logs, builder stages are called "stage i" by default
+func WithName(name string) Option {
+	return func(o *stageOptions) {
+		o.name = name
+	}
+}
+
+// WithBuffer sets the capacity of the channel where the stage sends its results (zero means unbuffered)
+func WithBuffer(n int) Option {
+	return func(o *stageOptions) {
+		o.buffer = max(n, 0)
+	}
+}
+
+// WithOverflow sets what happens when the consumer is not ready, not every stage supports every policy
+func WithOverflow(policy Overflow) Option {
+	return func(o *stageOptions) {
+		o.overflow = policy
+	}
+}
+
+// WithClock sets the clock used by the stages that depend on time, clock.Real by default
+func WithClock(c clock.Clock) Option {
+	return func(o *stageOptions) {
+		o.clock = c
+	}
+}
+
+// WithInterval sets how often a stage that reports periodically (Stats) sends its report
+func WithInterval(d time.Duration) Option {
+	return func(o *stageOptions) {
+		o.interval = d
+	}
+}
+
+// WithConcurrency runs the stage function in n goroutines reading from the same input,
+// the values leave the stage in the order they are finished, not in the order they arrived
+func WithConcurrency(n int) Option {
+	return func(o *stageOptions) {
+		o.concurrency = max(n, 1)
+	}
+}
+
+// WithLockFree makes the stage send its results through a lock-free queue (mpsc) instead of a channel,
+// it's only used when a single goroutine reads them (the next stage doesn't use WithConcurrency),
+// the overflow policies are ignored
+func WithLockFree() Option {
+	return func(o *stageOptions) {
+		o.lockFree = true
+	}
+}
+
+// WithBulkhead runs the stage function inside the bulkhead, stages sharing a bulkhead share its slots and waiting line,
+// a call rejected by a full bulkhead fails the stage with bulkhead.ErrFull
+func WithBulkhead(b *bulkhead.Bulkhead) Option {
+	return func(o *stageOptions) {
+		o.bulkhead = b
+	}
+}
+
+func newStageOptions(opts []Option) stageOptions {
+	o := stageOptions{clock: clock.Real, concurrency: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,148 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+)
+
+// ORDERED FAN-IN
+// merge interleaves values in whatever order the workers finish them.
+// When the output must follow the input order, every value is tagged with a sequence number
+// before the fan-out and the fan-in holds back early values until the missing ones arrive.
+
+// Sequenced is a value tagged with its position in the original stream
+type Sequenced[T any] struct {
+	Seq   uint64
+	Value T
+}
+
+// Sequence tags every value received from in with an increasing sequence number starting at zero
+func Sequence[T any](ctx context.Context, in <-chan T) <-chan Sequenced[T] {
+	out := make(chan Sequenced[T])
+	go func() {
+		defer close(out)
+		var seq uint64
+		for v := range in {
+			select {
+			case out <- Sequenced[T]{Seq: seq, Value: v}:
+				seq++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// KeepSequence turns a plain function into a stage that transforms the value and keeps its sequence number
+func KeepSequence[In, Out any](fn func(In) Out) Stage[Sequenced[In], Sequenced[Out]] {
+	return Lift(func(s Sequenced[In]) Sequenced[Out] {
+		return Sequenced[Out]{Seq: s.Seq, Value: fn(s.Value)}
+	})
+}
+
+// MergeOrdered multiplexes the input channels onto a single channel following the sequence numbers,
+// if a sequence number never shows up the values after it are flushed in order once every input is closed
+func MergeOrdered[T any](ctx context.Context, channels ...<-chan Sequenced[T]) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var next uint64
+		pending := make(map[uint64]T) // values that arrived before their turn
+
+		for s := range Merge(ctx, channels...) {
+			pending[s.Seq] = s.Value
+			for {
+				v, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				select {
+				case out <- v:
+					next++
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		// gaps in the sequence, send what is left in order
+		seqs := make([]uint64, 0, len(pending))
+		for seq := range pending {
+			seqs = append(seqs, seq)
+		}
+		slices.Sort(seqs)
+		for _, seq := range seqs {
+			select {
+			case out <- pending[seq]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// SORTED MERGE
+// When every input is already sorted (each shard sorted its own part) the merged stream can be sorted
+// without buffering everything: keep the next value of every input in a heap and always send the smallest one.
+// The stage must wait for a value (or the close) from every input before sending, a slow input slows everyone.
+
+// MergeSorted multiplexes inputs sorted by less onto a single sorted channel (k-way merge)
+func MergeSorted[T any](ctx context.Context, less func(a, b T) bool, channels ...<-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		h := &headHeap[T]{less: less}
+
+		// next reads the next value of the i-th input into the heap, it returns false if the context is done
+		next := func(i int) bool {
+			select {
+			case v, ok := <-channels[i]:
+				if ok {
+					heap.Push(h, head[T]{value: v, input: i})
+				}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for i := range channels {
+			if !next(i) {
+				return
+			}
+		}
+		for h.Len() > 0 {
+			first := heap.Pop(h).(head[T])
+			if !send(ctx, out, first.value) || !next(first.input) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// head is the next value of an input of MergeSorted
+type head[T any] struct {
+	value T
+	input int
+}
+
+// headHeap implements heap.Interface
+type headHeap[T any] struct {
+	heads []head[T]
+	less  func(a, b T) bool
+}
+
+func (h *headHeap[T]) Len() int           { return len(h.heads) }
+func (h *headHeap[T]) Less(i, j int) bool { return h.less(h.heads[i].value, h.heads[j].value) }
+func (h *headHeap[T]) Swap(i, j int)      { h.heads[i], h.heads[j] = h.heads[j], h.heads[i] }
+func (h *headHeap[T]) Push(x any)         { h.heads = append(h.heads, x.(head[T])) }
+func (h *headHeap[T]) Pop() any {
+	last := h.heads[len(h.heads)-1]
+	h.heads = h.heads[:len(h.heads)-1]
+	return last
+}
@@ -0,0 +1,31 @@
+package pipeline
+
+import "context"
+
+// OR-DONE
+// Ranging over a channel doesn't listen to the context: if the producer never closes the channel
+// the loop never ends. OrDone hides the select on both channels, so the loop stays a plain range.
+
+// OrDone forwards the values received from in until in is closed or the context is done
+func OrDone[T any](ctx context.Context, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
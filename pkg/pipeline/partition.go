@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// PARTITIONING
+// Fan-out gives each value to whichever worker is free, so two values with the same key
+// can be processed at the same time and finish in any order.
+// Partition routes by key instead: the same key always goes to the same output, in order.
+
+// Partition routes every value received from in to one of n channels by the hash of its key,
+// values with the same key always go to the same channel and keep their order
+func Partition[T any](ctx context.Context, in <-chan T, key func(T) string, n int) []<-chan T {
+	n = max(n, 1)
+	return partition(ctx, in, func(v T) int { return shard(key(v), n) }, n)
+}
+
+// partition routes every value received from in to the channel of the index returned by index
+func partition[T any](ctx context.Context, in <-chan T, index func(T) int, n int) []<-chan T {
+	outs := make([]chan T, n)
+	res := make([]<-chan T, len(outs))
+	for i := range outs {
+		outs[i] = make(chan T)
+		res[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		for v := range in {
+			if !send(ctx, outs[index(v)], v) {
+				return
+			}
+		}
+	}()
+	return res
+}
+
+// Split sends the values for which match returns true to the first channel and the rest to the second one,
+// both channels must be read
+func Split[T any](ctx context.Context, in <-chan T, match func(T) bool) (<-chan T, <-chan T) {
+	matched := make(chan T)
+	unmatched := make(chan T)
+	go func() {
+		defer close(matched)
+		defer close(unmatched)
+		for v := range in {
+			out := unmatched
+			if match(v) {
+				out = matched
+			}
+			if !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return matched, unmatched
+}
+
+// shard maps a key to one of n buckets with jump consistent hashing,
+// when n changes only about 1/n of the keys move to a different bucket
+func shard(key string, n int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	k := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
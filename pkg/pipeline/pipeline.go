@@ -120,16 +120,17 @@ func merge(ctx context.Context, channels ...<-chan int) <-chan int {
 func main() {
 	ctx := context.Background()            // CREATE A CONTEXT
 	ctx, cancel := context.WithCancel(ctx) // CANCEL FUNCTIONALITY
-	defer cancel() // DEFER CANCELLATION
+	defer cancel()                         // DEFER CANCELLATION
 
-	in := generate(ctx, 15, 2, 9, 23, 91)
+	// only three results are needed, TAKE cancels the upstream stages after reading them
+	out := Take(ctx, func(ctx context.Context) <-chan int {
+		in := generate(ctx, 15, 2, 9, 23, 91)
 
-	ch1 := power(ctx, in)
-	ch2 := power(ctx, in)
+		// FAN-OUT to two workers and FAN-IN their results
+		return merge(ctx, FanOut(ctx, in, 2, power)...)
+	}, 3)
 
-	out := merge(ctx, ch1, ch2)
-
-	for i := 0; i < 3; i++ {
-		fmt.Println(<-out)
+	for n := range out {
+		fmt.Println(n)
 	}
 }
@@ -0,0 +1,83 @@
+package pipelinetest
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// LEAK DETECTION
+// The whole point of cancellation is that no goroutine is left behind once the pipeline is over.
+// CheckLeaks takes a snapshot of the goroutines when the test starts and compares it with the ones
+// still running when the test ends: any new goroutine is a stage that never exited.
+
+// LeakTimeout is how long CheckLeaks waits for the goroutines to exit before failing the test
+var LeakTimeout = 2 * time.Second
+
+// CheckLeaks fails the test if goroutines started during the test are still running when it ends
+func CheckLeaks(t testing.TB) {
+	t.Helper()
+	before := goroutines()
+	t.Cleanup(func() {
+		var leaked []string
+		deadline := time.Now().Add(LeakTimeout)
+		for {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; !ok && !ignored(stack) {
+					leaked = append(leaked, stack)
+				}
+			}
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond) // give the goroutines time to exit
+		}
+		for _, stack := range leaked {
+			t.Errorf("leaked goroutine:\n%s", stack)
+		}
+	})
+}
+
+// goroutines returns the stack of every running goroutine by its id
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	res := make(map[string]string)
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		// every stack starts with "goroutine <id> [<state>]:"
+		header, _, _ := strings.Cut(g, "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		res[fields[1]] = g
+	}
+	return res
+}
+
+// ignored reports whether the goroutine belongs to the runtime or the testing package
+func ignored(stack string) bool {
+	for _, s := range []string{
+		"testing.tRunner",
+		"testing.(*T).Run",
+		"testing.runTests",
+		"runtime.goexit0",
+		"os/signal.signal_recv",
+		"runtime/trace.Start",
+	} {
+		if strings.Contains(stack, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package pipelinetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+)
+
+// TESTING PIPELINES
+// Concurrent code is usually tested with sleeps and hope. A recorder keeps a single, ordered log
+// of every value that goes in and out of every stage, so a test can assert on what happened
+// (counts, order of the values, which stage saw what) instead of when it happened.
+
+// Epoch is the instant the clocks returned by NewClock start at
+var Epoch = time.Date(2022, 4, 18, 0, 0, 0, 0, time.UTC)
+
+// NewClock returns a manual clock for the stages that depend on time (pass it with pipeline.WithClock),
+// every run starts at the same instant and time only moves with Advance, so every run sees the same windows and batches
+func NewClock() *clock.Manual {
+	return clock.NewManual(Epoch)
+}
+
+// Kind tells if a value was entering or leaving a stage
+type Kind int
+
+const (
+	// Recv is a value received by the stage
+	Recv Kind = iota
+	// Send is a value sent by the stage
+	Send
+)
+
+func (k Kind) String() string {
+	if k == Recv {
+		return "recv"
+	}
+	return "send"
+}
+
+// Event is a single value going through a stage
+type Event struct {
+	Seq   int // position in the log
+	Stage string
+	Kind  Kind
+	Value any
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("#%d %s %s %v", e.Seq, e.Stage, e.Kind, e.Value)
+}
+
+// Recorder is the log of a pipeline run, it's safe for concurrent use
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// NewRecorder creates an empty log
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) record(stage string, kind Kind, v any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, Event{Seq: len(r.events), Stage: stage, Kind: kind, Value: v})
+}
+
+// Tap records every value received from in as sent by the stage, it's meant to be placed
+// right after the stage under observation in a pipeline built with channels
+func Tap[T any](ctx context.Context, r *Recorder, stage string, in <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for v := range in {
+			r.record(stage, Send, v)
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Observe is a builder middleware recording the values received and sent by every stage
+func Observe[T any](r *Recorder) pipeline.Middleware[T] {
+	return func(next pipeline.StageFunc[T]) pipeline.StageFunc[T] {
+		return func(ctx context.Context, v T) (T, error) {
+			stage := pipeline.StageName(ctx)
+			r.record(stage, Recv, v)
+			res, err := next(ctx, v)
+			if err == nil {
+				r.record(stage, Send, res)
+			}
+			return res, err
+		}
+	}
+}
+
+// Events returns a copy of the log
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Values returns the values of the given kind recorded for the stage, in order
+func (r *Recorder) Values(stage string, kind Kind) []any {
+	var vals []any
+	for _, e := range r.Events() {
+		if e.Stage == stage && e.Kind == kind {
+			vals = append(vals, e.Value)
+		}
+	}
+	return vals
+}
+
+// AssertCount fails the test if the stage did not send exactly n values
+func (r *Recorder) AssertCount(t testing.TB, stage string, n int) {
+	t.Helper()
+	if got := len(r.Values(stage, Send)); got != n {
+		t.Errorf("stage %q sent %d values, want %d", stage, got, n)
+	}
+}
+
+// AssertOrder fails the test if the stage did not send exactly the given values in that order
+func (r *Recorder) AssertOrder(t testing.TB, stage string, want ...any) {
+	t.Helper()
+	if got := r.Values(stage, Send); !reflect.DeepEqual(got, want) {
+		t.Errorf("stage %q sent %v, want %v", stage, got, want)
+	}
+}
+
+// AssertSentBefore fails the test if the first value was not sent by stage a before the second one by stage b
+func (r *Recorder) AssertSentBefore(t testing.TB, a string, va any, b string, vb any) {
+	t.Helper()
+	first, second := -1, -1
+	for _, e := range r.Events() {
+		if e.Kind != Send {
+			continue
+		}
+		if first < 0 && e.Stage == a && reflect.DeepEqual(e.Value, va) {
+			first = e.Seq
+		}
+		if second < 0 && e.Stage == b && reflect.DeepEqual(e.Value, vb) {
+			second = e.Seq
+		}
+	}
+	if first < 0 || second < 0 || first > second {
+		t.Errorf("%q sent %v at #%d, %q sent %v at #%d, want the first one before", a, va, first, b, vb, second)
+	}
+}
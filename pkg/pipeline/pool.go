@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// POOLED ENVELOPES
+// An envelope per value means an allocation per value, at millions of values per second the garbage collector
+// spends more time cleaning envelopes than the stages spend processing values. A sync.Pool recycles them:
+// the source takes an envelope from the pool and the sink puts it back once it's done with it.
+// After Put the envelope belongs to the pool again, using it is a bug (like using a slice after appending to it).
+// Putting it back twice is a bug too: two owners of the same envelope would corrupt each other. Put panics
+// if the envelope is still in the pool, but once a Get has handed it out again the second Put can't be told
+// from the Put of the new owner, so the check is best effort only.
+
+// Pool recycles the envelopes carrying values of type T
+type Pool[T any] struct {
+	p sync.Pool
+}
+
+// NewPool creates an empty pool
+func NewPool[T any]() *Pool[T] {
+	pool := &Pool[T]{}
+	pool.p.New = func() any {
+		return &Envelope[T]{}
+	}
+	return pool
+}
+
+// Get returns an envelope from the pool carrying the value and its context
+func (p *Pool[T]) Get(ctx context.Context, v T) *Envelope[T] {
+	e := p.p.Get().(*Envelope[T])
+	e.ctx, e.Value, e.pooled = ctx, v, false
+	return e
+}
+
+// Put gives the envelope back to the pool, the envelope must not be used afterwards,
+// it panics if the envelope is still in the pool (best effort, see above)
+func (p *Pool[T]) Put(e *Envelope[T]) {
+	if e.pooled {
+		panic("pipeline: envelope put back twice")
+	}
+	*e = Envelope[T]{pooled: true} // don't keep the value alive while the envelope waits in the pool
+	p.p.Put(e)
+}
+
+// WrapPooled puts every value received from in into an envelope taken from the pool,
+// itemCtx derives the context of each value like in Wrap
+func WrapPooled[T any](ctx context.Context, in <-chan T, pool *Pool[T], itemCtx func(ctx context.Context, v T) context.Context) <-chan *Envelope[T] {
+	out := make(chan *Envelope[T])
+	go func() {
+		defer close(out)
+		for v := range in {
+			c := ctx
+			if itemCtx != nil {
+				c = itemCtx(ctx, v)
+			}
+			e := pool.Get(c, v)
+			if !send(ctx, out, e) {
+				pool.Put(e)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// ReleaseEach calls fn with the context and the value of every envelope received from in and puts the envelope
+// back in the pool once fn returns, it stops at the first error, the envelopes still in the channel are left to the garbage collector
+func ReleaseEach[T any](ctx context.Context, in <-chan *Envelope[T], pool *Pool[T], fn func(ctx context.Context, v T) error) error {
+	return ForEach(ctx, in, func(e *Envelope[T]) error {
+		defer pool.Put(e)
+		return fn(e.Context(), e.Value)
+	})
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// WARM-UP
+// The first values of a run pay for starting it: goroutines are spawned, channels allocated, pools filled.
+// Prepare does that work up front: every stage goroutine is started and waits on its input,
+// only the source is held back until Start is called, so the first value finds the pipeline ready.
+
+// Prepared is a pipeline whose stages are running, waiting for its source to be opened
+type Prepared struct {
+	warm *warmup
+	done chan struct{}
+	err  error
+}
+
+// Prepare starts every stage of the pipeline without starting its source, Ready tells when they are all running
+// and Start opens the source, cancelling the context before Start stops the stages like it stops a run
+func (p *Pipeline[T]) Prepare(ctx context.Context) *Prepared {
+	w := &Prepared{
+		warm: &warmup{open: make(chan struct{}), readyc: make(chan struct{})},
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(w.done)
+		w.err = p.execute(ctx, p.sink, w.warm)
+		w.warm.ready() // the run failed before its stages were started
+	}()
+	return w
+}
+
+// Ready is closed when every stage goroutine has been spawned and every buffer allocated,
+// or when the pipeline failed to start (Run returns why)
+func (w *Prepared) Ready() <-chan struct{} {
+	return w.warm.readyc
+}
+
+// Start opens the source, it can be called more than once
+func (w *Prepared) Start() {
+	w.warm.start.Do(func() { close(w.warm.open) })
+}
+
+// Run opens the source and blocks until the pipeline stops, like Pipeline.Run
+func (w *Prepared) Run() error {
+	w.Start()
+	<-w.done
+	return w.err
+}
+
+// warmup holds a run back until it's opened
+type warmup struct {
+	open   chan struct{} // closed by Start
+	readyc chan struct{} // closed once the stages are running
+	start  sync.Once
+	once   sync.Once
+}
+
+// ready closes the ready channel, it's a no-op without a warm-up
+func (w *warmup) ready() {
+	if w == nil {
+		return
+	}
+	w.once.Do(func() { close(w.readyc) })
+}
+
+// gated builds the source only once open is closed and forwards its values,
+// the channel is closed without building the source if ctx is done first
+func gated[T any](ctx context.Context, open <-chan struct{}, source func() <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		select {
+		case <-open:
+		case <-ctx.Done():
+			return
+		}
+		if ctx.Err() != nil {
+			return // cancelled and opened at the same time
+		}
+		for v := range OrDone(ctx, source()) {
+			if !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// PRESETS
+// A few topologies come up again and again, and the hard part is never the stage logic but the wiring:
+// which context builds the source, who drains what when a worker fails, where the buffers go.
+// These presets assemble the whole shape in one call: the source is built with a context they own,
+// the first error cancels everything, and they return only once every goroutine they started is done.
+
+// MapReduce builds the source, maps every value into a key and a value with workers goroutines and reduces
+// the values of every key with reduceFn, which must be associative and commutative (every worker reduces
+// its share first and the partial results are reduced at the end), the first error stops everything
+func MapReduce[T any, K comparable, V any](ctx context.Context, source SourceFunc[T], mapFn func(ctx context.Context, v T) (K, V, error), reduceFn func(acc, v V) V, workers int) (map[K]V, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	errs := &errOnce{cancel: cancel}
+	in := source(ctx)
+
+	partials := make([]map[K]V, max(workers, 1))
+	var wg sync.WaitGroup
+	for i := range partials {
+		partials[i] = make(map[K]V)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range OrDone(ctx, in) {
+				k, res, err := mapFn(ctx, v)
+				if err != nil {
+					errs.set(fmt.Errorf("pipeline: map: %w", err))
+					return
+				}
+				if acc, ok := partials[i][k]; ok {
+					res = reduceFn(acc, res)
+				}
+				partials[i][k] = res
+			}
+		}()
+	}
+	wg.Wait()
+	cancel(nil)
+	for range in {
+		// wait for the source to exit
+	}
+
+	if err := errs.get(); err != nil {
+		return nil, err
+	}
+	if err := context.Cause(parent); err != nil {
+		return nil, err
+	}
+	res := partials[0]
+	for _, partial := range partials[1:] {
+		for k, v := range partial {
+			if acc, ok := res[k]; ok {
+				v = reduceFn(acc, v)
+			}
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// ScatterGather builds the source and sends every value to all the handlers at the same time,
+// once every handler has answered their results are sent together (in the order of the handlers),
+// workers values are scattered at the same time so the results may leave out of order,
+// the first error cancels everything and is sent to the second channel
+func ScatterGather[In, Out any](ctx context.Context, source SourceFunc[In], workers int, handlers ...func(ctx context.Context, v In) (Out, error)) (<-chan []Out, <-chan error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	errs := &errOnce{cancel: cancel}
+	in := source(ctx)
+	out := make(chan []Out, max(workers, 1)) // room for a result per worker, a slow reader doesn't hold the handlers
+	errc := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range OrDone(ctx, in) {
+				res, err := gather(ctx, v, handlers)
+				if err != nil {
+					errs.set(err)
+					return
+				}
+				if !send(ctx, out, res) {
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+		wg.Wait()
+		cancel(nil)
+		for range in {
+			// wait for the source to exit
+		}
+		if err := errs.get(); err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
+
+// gather calls every handler with v in its own goroutine, the first error cancels the others
+func gather[In, Out any](ctx context.Context, v In, handlers []func(context.Context, In) (Out, error)) ([]Out, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	errs := &errOnce{cancel: cancel}
+
+	res := make([]Out, len(handlers))
+	var wg sync.WaitGroup
+	for i, h := range handlers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := h(ctx, v)
+			if err != nil {
+				errs.set(fmt.Errorf("pipeline: handler %d: %w", i, err))
+				return
+			}
+			res[i] = r
+		}()
+	}
+	wg.Wait()
+	return res, errs.get()
+}
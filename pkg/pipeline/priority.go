@@ -0,0 +1,58 @@
+package pipeline
+
+import "context"
+
+// PRIORITY MERGE
+// When several cases of a select are ready, one is chosen at random, so merge treats every input the same.
+// To prefer one channel, a first select only looks at the high priority channel (with a default case
+// so it doesn't block) and only when it's empty a second select waits on both.
+
+// MergePriority multiplexes both channels onto a single channel,
+// values from high are always sent first when both channels have values ready
+func MergePriority[T any](ctx context.Context, high, low <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		send := func(v T) bool {
+			select {
+			case out <- v:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for high != nil || low != nil {
+			// NESTED SELECT: high priority only
+			select {
+			case v, ok := <-high:
+				if !ok {
+					high = nil // a nil channel is never ready
+				} else if !send(v) {
+					return
+				}
+				continue
+			default:
+			}
+
+			// nothing on high, wait on both
+			select {
+			case v, ok := <-high:
+				if !ok {
+					high = nil
+				} else if !send(v) {
+					return
+				}
+			case v, ok := <-low:
+				if !ok {
+					low = nil
+				} else if !send(v) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// QUARANTINE
+// Some values are poison: a malformed payload that makes the parser panic, a request that always hangs.
+// Retrying them forever blocks a worker, and failing the pipeline because of one of them stops everything.
+// A stage in quarantine mode gives every value a few attempts, each one with a timeout and with its panics
+// recovered, and a value that keeps crashing or timing out is sent to a side output (as a Failed value)
+// and skipped, so the rest of the values keep flowing. Ordinary errors are not retried.
+
+// ErrQuarantined is the error of a value sent to the quarantine, the stage skips it without failing
+var ErrQuarantined = errors.New("pipeline: quarantined")
+
+type quarantine struct {
+	side     string
+	attempts int
+	timeout  time.Duration
+}
+
+// WithQuarantine gives every value of a builder stage up to attempts tries, every try times out after timeout
+// (zero means no timeout) and its panics are recovered, a value that panics or times out in every try is sent
+// to the side output with the given name as a Failed[T] and skipped, the side output must be wired with SideOutput
+func WithQuarantine(side string, attempts int, timeout time.Duration) Option {
+	return func(o *stageOptions) {
+		o.quarantine = &quarantine{side: side, attempts: max(attempts, 1), timeout: max(timeout, 0)}
+	}
+}
+
+// quarantined calls fn as many times as the quarantine allows while it panics or times out
+func quarantined[T any](q *quarantine, fn StageFunc[T]) StageFunc[T] {
+	fn = Recover(fn)
+	return func(ctx context.Context, v T) (T, error) {
+		var err error
+		for range q.attempts {
+			var res T
+			if q.timeout > 0 {
+				res, err = callWithTimeout(ctx, v, fn, q.timeout)
+			} else {
+				res, err = fn(ctx, v)
+			}
+			if err == nil || !poisoned(ctx, err) {
+				return res, err
+			}
+		}
+		var zero T
+		if err := Emit(ctx, q.side, Failed[T]{Value: v, Err: err, Attempts: q.attempts}); err != nil {
+			return zero, err
+		}
+		return zero, fmt.Errorf("%w after %d attempts: %w", ErrQuarantined, q.attempts, err)
+	}
+}
+
+// poisoned reports whether the error is a panic or a timeout of the try (and not of the pipeline)
+func poisoned(ctx context.Context, err error) bool {
+	var perr *PanicError
+	if errors.As(err, &perr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil
+}
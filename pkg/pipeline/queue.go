@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// QUEUING
+// A queue between two stages lets the producer work ahead of the consumer by up to capacity values,
+// when the queue is full the producer blocks again. It doesn't make the pipeline faster (the slowest stage
+// still sets the pace) but it absorbs bursts and decouples stages that work at uneven speeds.
+// The stats tell whether the capacity is right: a queue always empty isn't needed, one always full is too small.
+
+// QueueStats exposes the state of a queue stage
+type QueueStats struct {
+	capacity  int
+	length    atomic.Int64
+	highWater atomic.Int64
+}
+
+// Len returns the number of values waiting in the queue
+func (s *QueueStats) Len() int {
+	return int(s.length.Load())
+}
+
+// HighWater returns the largest number of values that have been waiting in the queue at the same time
+func (s *QueueStats) HighWater() int {
+	return int(s.highWater.Load())
+}
+
+// Cap returns the capacity of the queue
+func (s *QueueStats) Cap() int {
+	return s.capacity
+}
+
+// Queue forwards the values received from in keeping up to capacity values for a slow consumer,
+// when the queue is full it stops reading from in until the consumer catches up
+func Queue[T any](ctx context.Context, in <-chan T, capacity int) (<-chan T, *QueueStats) {
+	capacity = max(capacity, 1)
+	out := make(chan T)
+	stats := &QueueStats{capacity: capacity}
+	go func() {
+		defer close(out)
+		buf := make([]T, capacity)
+		var head, size int // buf[head] is the oldest value
+
+		for in != nil || size > 0 {
+			// a nil channel blocks forever, so each case is only enabled when it can proceed
+			var recvCh <-chan T
+			if size < capacity {
+				recvCh = in
+			}
+			var sendCh chan T
+			var next T
+			if size > 0 {
+				sendCh, next = out, buf[head]
+			}
+
+			select {
+			case v, ok := <-recvCh:
+				if !ok {
+					in = nil // flush what is left
+					continue
+				}
+				buf[(head+size)%capacity] = v
+				size++
+				if int64(size) > stats.highWater.Load() {
+					stats.highWater.Store(int64(size))
+				}
+			case sendCh <- next:
+				var zero T
+				buf[head] = zero
+				head = (head + 1) % capacity
+				size--
+			case <-ctx.Done():
+				return
+			}
+			stats.length.Store(int64(size))
+		}
+	}()
+	return out, stats
+}
@@ -0,0 +1,88 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RECORD AND REPLAY
+// A bug that only shows up with production traffic is hard to reproduce on a laptop.
+// Record tees the values flowing through a point of the pipeline to a writer (JSON lines with the time
+// every value passed), and Replay reads them back as a source, with the original pauses between them
+// or faster, so the same traffic can be sent again and again to the stages being debugged.
+
+// recorded is a line written by Record
+type recorded[T any] struct {
+	At    time.Time `json:"at"`
+	Value T         `json:"value"`
+}
+
+// Record forwards every value received from in and writes it with the time it passed to w as a JSON line,
+// the first write error is sent to the second channel and stops the recording but not the values, it accepts WithClock
+func Record[T any](ctx context.Context, in <-chan T, w io.Writer, opts ...Option) (<-chan T, <-chan error) {
+	o := newStageOptions(opts)
+	out := make(chan T)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errc)
+		enc := json.NewEncoder(w) // one value per line
+		recording := true
+		for v := range OrDone(ctx, in) {
+			if recording {
+				if err := enc.Encode(recorded[T]{At: o.clock.Now(), Value: v}); err != nil {
+					errc <- fmt.Errorf("pipeline: record: %w", err)
+					recording = false
+				}
+			}
+			if !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out, errc
+}
+
+// Replay sends the values recorded by Record in r, waiting between them the time that passed between them
+// divided by speed (2 replays twice as fast, 0 doesn't wait at all),
+// a read error is sent to the second channel and stops the replay, it accepts WithClock
+func Replay[T any](ctx context.Context, r io.Reader, speed float64, opts ...Option) (<-chan T, <-chan error) {
+	o := newStageOptions(opts)
+	out := make(chan T)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errc)
+		dec := json.NewDecoder(r)
+		var last time.Time
+		for {
+			var rec recorded[T]
+			if err := dec.Decode(&rec); err != nil {
+				if !errors.Is(err, io.EOF) {
+					errc <- fmt.Errorf("pipeline: replay: %w", err)
+				}
+				return
+			}
+			if speed > 0 && !last.IsZero() {
+				if gap := rec.At.Sub(last); gap > 0 {
+					timer := o.clock.NewTimer(time.Duration(float64(gap) / speed))
+					select {
+					case <-timer.C():
+					case <-ctx.Done():
+						timer.Stop()
+						return
+					}
+				}
+			}
+			last = rec.At
+			if !send(ctx, out, rec.Value) {
+				return
+			}
+		}
+	}()
+	return out, errc
+}
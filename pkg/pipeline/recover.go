@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// PANIC RECOVERY
+// A panic in a stage goroutine can't be recovered by the caller of Run (recover only works in the same goroutine)
+// so it crashes the whole process. Recovering inside the stage turns the panic into an ordinary error:
+// it can stop the pipeline like any other error, or only drop the value that caused it.
+
+// PanicError is the error produced by a stage function that panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("pipeline: panic: %v\n%s", e.Value, e.Stack)
+}
+
+// PanicPolicy decides what the pipeline does after recovering from a panic
+type PanicPolicy int
+
+const (
+	// Teardown stops the pipeline, Run returns the PanicError
+	Teardown PanicPolicy = iota
+	// Continue drops the value that caused the panic and keeps the pipeline running
+	Continue
+)
+
+// Recover wraps a stage function so a panic is returned as a *PanicError
+func Recover[T any](fn StageFunc[T]) StageFunc[T] {
+	return func(ctx context.Context, v T) (res T, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return fn(ctx, v)
+	}
+}
+
+// Recover makes every stage recover from panics, with Continue the recovered panics are passed to report (if not nil)
+func (p *Pipeline[T]) Recover(policy PanicPolicy, report func(err error)) *Pipeline[T] {
+	p.recover = &recoverPolicy{policy: policy, report: report}
+	return p
+}
+
+type recoverPolicy struct {
+	policy PanicPolicy
+	report func(err error)
+}
+
+// skip reports whether the stage error is a panic the pipeline should survive
+func (r *recoverPolicy) skip(err error) bool {
+	var perr *PanicError
+	if r == nil || r.policy != Continue || !errors.As(err, &perr) {
+		return false
+	}
+	if r.report != nil {
+		r.report(err)
+	}
+	return true
+}
@@ -0,0 +1,44 @@
+package pipeline
+
+import "context"
+
+// INFINITE GENERATORS
+// generate stops after the last number, these sources never stop on their own:
+// the only way out is the context, so they are usually combined with Take.
+
+// Repeat sends the values over and over, in order, until the context is done
+func Repeat[T any](ctx context.Context, values ...T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		if len(values) == 0 {
+			return
+		}
+		for {
+			for _, v := range values {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// RepeatFn sends the result of calling fn over and over until the context is done
+func RepeatFn[T any](ctx context.Context, fn func() T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case out <- fn():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RETRIES
+// Transient failures (timeouts, throttling) usually go away if the call is repeated a bit later.
+// Waiting longer after every attempt (exponential backoff) gives the dependency time to recover,
+// and a random jitter avoids every worker retrying at the same instant.
+// Values that still fail, or fail with an error that is not worth retrying, go to a dead-letter channel.
+
+// RetryPolicy configures Retry, the zero value tries every value once
+type RetryPolicy struct {
+	MaxAttempts    int                  // total attempts including the first one
+	InitialBackoff time.Duration        // wait before the second attempt
+	MaxBackoff     time.Duration        // upper bound of the wait, zero means no bound
+	Multiplier     float64              // growth of the wait after every attempt, 2 if not set
+	Jitter         float64              // fraction of the wait that is randomized, between 0 and 1
+	Retryable      func(err error) bool // nil means every error is retryable
+}
+
+// Failed is a value that could not be processed, sent to the dead-letter channel
+type Failed[T any] struct {
+	Value    T
+	Err      error
+	Attempts int
+}
+
+// Retry applies fn to every value received from in, retrying it according to the policy,
+// successes are sent to the first channel and failures to the second one, both channels must be read
+func Retry[In, Out any](ctx context.Context, in <-chan In, fn func(context.Context, In) (Out, error), policy RetryPolicy) (<-chan Out, <-chan Failed[In]) {
+	out := make(chan Out)
+	dead := make(chan Failed[In])
+	go func() {
+		defer close(out)
+		defer close(dead)
+		for v := range in {
+			res, attempts, err := retry(ctx, policy, func(ctx context.Context) (Out, error) {
+				return fn(ctx, v)
+			})
+			if err != nil {
+				select {
+				case dead <- Failed[In]{Value: v, Err: err, Attempts: attempts}:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, dead
+}
+
+// retry calls fn until it succeeds, fails with a fatal error or runs out of attempts
+func retry[T any](ctx context.Context, p RetryPolicy, fn func(context.Context) (T, error)) (T, int, error) {
+	attempts := max(p.MaxAttempts, 1)
+	var zero T
+	var err error
+	for attempt := 1; ; attempt++ {
+		var res T
+		res, err = fn(ctx)
+		if err == nil {
+			return res, attempt, nil
+		}
+		if attempt == attempts || (p.Retryable != nil && !p.Retryable(err)) {
+			return zero, attempt, err
+		}
+		if !sleep(ctx, p.backoff(attempt)) {
+			return zero, attempt, ctx.Err()
+		}
+	}
+}
+
+// backoff returns the wait after the given attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	mult := p.Multiplier
+	if mult <= 0 {
+		mult = 2
+	}
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= mult
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		d -= d * min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// sleep waits for d, it returns false if the context is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// RING BUFFER
+// A buffered channel blocks the sender once it's full. A ring buffer never blocks the sender:
+// when it's full the oldest value is evicted to make room, so the consumer always gets the freshest data.
+// The buffer lives inside a goroutine that owns it, no locks needed.
+
+// RingStats exposes the state of a ring buffer stage
+type RingStats struct {
+	evicted atomic.Int64
+	length  atomic.Int64
+}
+
+// Evicted returns the number of values discarded to make room for newer ones
+func (s *RingStats) Evicted() int64 {
+	return s.evicted.Load()
+}
+
+// Len returns the number of values waiting in the buffer
+func (s *RingStats) Len() int {
+	return int(s.length.Load())
+}
+
+// RingBuffer forwards the values received from in keeping up to capacity values for a slow consumer,
+// the input is always read right away, when the buffer is full the oldest value is evicted
+func RingBuffer[T any](ctx context.Context, in <-chan T, capacity int) (<-chan T, *RingStats) {
+	capacity = max(capacity, 1)
+	out := make(chan T)
+	stats := &RingStats{}
+	go func() {
+		defer close(out)
+		buf := make([]T, capacity)
+		var head, size int // buf[head] is the oldest value
+
+		for in != nil || size > 0 {
+			// only try to send when there is something buffered
+			var sendCh chan T
+			var next T
+			if size > 0 {
+				sendCh, next = out, buf[head]
+			}
+
+			select {
+			case v, ok := <-in:
+				if !ok {
+					in = nil // flush what is left
+					continue
+				}
+				if size == capacity {
+					head = (head + 1) % capacity // EVICT THE OLDEST
+					size--
+					stats.evicted.Add(1)
+				}
+				buf[(head+size)%capacity] = v
+				size++
+			case sendCh <- next:
+				var zero T
+				buf[head] = zero // don't keep a reference to a value already sent
+				head = (head + 1) % capacity
+				size--
+			case <-ctx.Done():
+				return
+			}
+			stats.length.Store(int64(size))
+		}
+	}()
+	return out, stats
+}
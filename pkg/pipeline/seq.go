@@ -0,0 +1,46 @@
+//go:build go1.23
+
+package pipeline
+
+import (
+	"context"
+	"iter"
+)
+
+// ITERATORS
+// Since Go 1.23 the standard library speaks iter.Seq: slices.Values, maps.Keys, bufio scanners wrapped by users...
+// FromSeq turns any of them into a source channel and ToSeq turns a channel back into an iterator,
+// so a pipeline can be fed with slices.Values(s) and its output ranged over or passed to slices.Collect.
+
+// FromSeq sends every value produced by seq to the returned channel, it stops pulling values once the context is done
+func FromSeq[T any](ctx context.Context, seq iter.Seq[T]) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for v := range seq {
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// ToSeq returns an iterator over the values received from in, it ends when in is closed or the context is done,
+// a loop that breaks early leaves the upstream stages blocked unless their context is cancelled
+func ToSeq[T any](ctx context.Context, in <-chan T) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok || !yield(v) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+)
+
+// LOAD SHEDDING
+// Under overload the queues grow and every value waits longer, until all of them miss their deadline.
+// Shed watches the time a value takes from the entry of the stage to the end of the pipeline and,
+// when it goes over the target, drops a share of the new values before they cost anything,
+// the further over the target the bigger the share. Some values always get in, to keep measuring.
+
+// maxShed is the largest share of the values Shed drops, the values let through keep the latency up to date
+const maxShed = 0.9
+
+// Admitted is a value let through by Shed, Done must be called once it has been processed
+type Admitted[T any] struct {
+	Value T
+
+	at    time.Time
+	stats *ShedStats
+}
+
+// Done records how long the value took since it was admitted
+func (a Admitted[T]) Done() {
+	if a.stats != nil {
+		a.stats.observe(a.stats.clock.Now().Sub(a.at))
+	}
+}
+
+// ShedStats exposes the state of a Shed stage
+type ShedStats struct {
+	shed     atomic.Int64
+	admitted atomic.Int64
+
+	clock   clock.Clock
+	mu      sync.Mutex
+	latency time.Duration // moving average of the latency of the values marked as done
+}
+
+// Shed returns the number of values dropped
+func (s *ShedStats) Shed() int64 {
+	return s.shed.Load()
+}
+
+// Admitted returns the number of values let through
+func (s *ShedStats) Admitted() int64 {
+	return s.admitted.Load()
+}
+
+// Latency returns the moving average of the latency of the values marked as done
+func (s *ShedStats) Latency() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latency
+}
+
+// observe adds a latency to the moving average, recent values weigh more
+func (s *ShedStats) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latency == 0 {
+		s.latency = d
+		return
+	}
+	s.latency += (d - s.latency) / 5
+}
+
+// dropRate is the share of the values to drop, zero while the latency is within the target
+func (s *ShedStats) dropRate(target time.Duration) float64 {
+	over := s.Latency() - target
+	if over <= 0 || target <= 0 {
+		return 0
+	}
+	return math.Min(float64(over)/float64(target), maxShed)
+}
+
+// Shed forwards the values received from in while their latency is within targetLatency,
+// above it a share of the values is dropped at random, growing with the latency up to 90%,
+// the latency of a value is measured until its Done is called, it accepts WithClock
+func Shed[T any](ctx context.Context, in <-chan T, targetLatency time.Duration, opts ...Option) (<-chan Admitted[T], *ShedStats) {
+	o := newStageOptions(opts)
+	out := make(chan Admitted[T])
+	stats := &ShedStats{clock: o.clock}
+	go func() {
+		defer close(out)
+		for v := range in {
+			if rate := stats.dropRate(targetLatency); rate > 0 && rand.Float64() < rate {
+				stats.shed.Add(1)
+				continue
+			}
+			if !send(ctx, out, Admitted[T]{Value: v, at: o.clock.Now(), stats: stats}) {
+				return
+			}
+			stats.admitted.Add(1)
+		}
+	}()
+	return out, stats
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SIDE OUTPUTS
+// A stage has one output, but not every result belongs to it: invalid values, audit records or metrics
+// are usually squeezed into the main type or logged and lost. Like Beam's multi-output transforms,
+// a stage function can Emit values to named side outputs, every side output has its own sink
+// running in its own goroutine, and a slow side sink slows down the stages emitting to it (backpressure).
+
+// ErrNoSideOutput is returned by Emit when the pipeline has no side output with that name
+var ErrNoSideOutput = errors.New("pipeline: no side output")
+
+// sideOutput is a side output registered on the builder
+type sideOutput struct {
+	name string
+	sink SinkFunc[any]
+	opts stageOptions
+}
+
+type sideOutputsKey struct{}
+
+// SideOutput wires the side output with the given name to its own sink, it accepts WithBuffer (DefaultBuffer by default),
+// an error returned by the sink stops the pipeline like any other stage error
+func (p *Pipeline[T]) SideOutput(name string, sink SinkFunc[any], opts ...Option) *Pipeline[T] {
+	opts = append([]Option{WithBuffer(DefaultBuffer)}, opts...)
+	p.sides = append(p.sides, sideOutput{name: name, sink: sink, opts: newStageOptions(opts)})
+	return p
+}
+
+// Emit sends v to the side output with the given name, ctx must be the one received by a stage function or the sink,
+// it blocks while the side output is full
+func Emit(ctx context.Context, name string, v any) error {
+	outs, _ := ctx.Value(sideOutputsKey{}).(map[string]chan any)
+	out, ok := outs[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrNoSideOutput, name)
+	}
+	select {
+	case out <- v:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// startSideOutputs runs the sinks of the side outputs and returns the context their channels are reachable from
+// and a function that closes them, it must be called once nobody can Emit anymore
+func (p *Pipeline[T]) startSideOutputs(ctx context.Context, r *run) (context.Context, func()) {
+	if len(p.sides) == 0 {
+		return ctx, func() {}
+	}
+	outs := make(map[string]chan any, len(p.sides))
+	for _, s := range p.sides {
+		out := make(chan any, s.opts.buffer)
+		outs[s.name] = out
+		r.track(s.name, func() (int, int) { return len(out), cap(out) })
+
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer p.hooks.onStageExit(s.name)
+			for v := range out {
+				if ctx.Err() != nil {
+					continue // keep draining so the stages emitting can exit
+				}
+				if err := s.sink(ctx, v); err != nil {
+					err = fmt.Errorf("pipeline: %s: %w", s.name, err)
+					p.hooks.onStageError(s.name, err)
+					if r.log != nil {
+						r.log.Error("item failed", "stage", s.name, "error", err)
+					}
+					r.errs.set(err)
+				}
+			}
+		}()
+	}
+	return context.WithValue(ctx, sideOutputsKey{}, outs), func() {
+		for _, out := range outs {
+			close(out)
+		}
+	}
+}
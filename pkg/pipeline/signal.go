@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SIGNALS
+// Every service embedding a pipeline ends up writing the same main: on the first Ctrl+C stop reading
+// and let the values in flight finish (graceful drain), on the second one stop right away (hard cancel).
+// RunWithSignals is that main.
+
+// ErrInterrupted is the cause of the cancellation when a second signal arrives during the drain
+var ErrInterrupted = errors.New("pipeline: interrupted")
+
+// defaultSignals are the signals handled when none are given
+var defaultSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// RunWithSignals runs the pipeline until it's done, the first signal shuts it down gracefully
+// and the second one cancels it (Run returns ErrInterrupted), SIGINT and SIGTERM if no signals are given,
+// a signal that arrives before the pipeline has started stops it as soon as it starts (see Runnable)
+func RunWithSignals(ctx context.Context, p Runnable, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = defaultSignals
+	}
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, signals...)
+	defer signal.Stop(sigs)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.Run(ctx)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-sigs:
+	}
+
+	// GRACEFUL DRAIN, unless a second signal arrives first
+	go func() {
+		select {
+		case <-sigs:
+			cancel(ErrInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+	_ = p.Shutdown(ctx)
+	return <-errc
+}
@@ -0,0 +1,80 @@
+//go:build unix
+
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline/pipelinetest"
+)
+
+// lateStart is a pipeline that takes a while to start running
+type lateStart struct {
+	*pipeline.Pipeline[int]
+}
+
+func (l lateStart) Run(ctx context.Context) error {
+	time.Sleep(50 * time.Millisecond)
+	return l.Pipeline.Run(ctx)
+}
+
+// signalSoon sends the signal to the process once RunWithSignals is listening for it
+func signalSoon(t *testing.T, after time.Duration) {
+	t.Helper()
+	time.AfterFunc(after, func() {
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func runWithSignals(t *testing.T, p pipeline.Runnable) error {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- pipeline.RunWithSignals(context.Background(), p, syscall.SIGUSR1)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunWithSignals didn't return")
+		return nil
+	}
+}
+
+func TestRunWithSignalsBeforeStart(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	p := pipeline.New[int]().From(func(ctx context.Context) <-chan int {
+		return pipeline.Repeat(ctx, 1) // never ends on its own
+	})
+
+	// the signal arrives before the pipeline is running, the shutdown must not be lost
+	signalSoon(t, 10*time.Millisecond)
+	if err := runWithSignals(t, lateStart{p}); err != nil {
+		t.Errorf("got %v, want a graceful shutdown", err)
+	}
+}
+
+func TestRunWithSignalsSecondSignal(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	p := pipeline.New[int]().
+		From(func(ctx context.Context) <-chan int {
+			return pipeline.Repeat(ctx, 1)
+		}).
+		Stage(func(ctx context.Context, v int) (int, error) {
+			<-ctx.Done() // the drain never finishes
+			return 0, context.Cause(ctx)
+		})
+
+	signalSoon(t, 10*time.Millisecond)
+	signalSoon(t, 50*time.Millisecond)
+	if err := runWithSignals(t, p); !errors.Is(err, pipeline.ErrInterrupted) {
+		t.Errorf("got %v, want %v", err, pipeline.ErrInterrupted)
+	}
+}
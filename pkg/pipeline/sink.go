@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+)
+
+// SINKS
+// The last stage always looks the same: range over the channel until it's closed or the context is done.
+// These helpers are that loop, they block until the input is consumed.
+// When a sink returns early (error or context) the upstream stages must be cancelled by the caller,
+// otherwise they stay blocked on their sends.
+
+// Collect reads every value received from in into a slice,
+// if the context is done first it returns the values read so far and the context error
+func Collect[T any](ctx context.Context, in <-chan T) ([]T, error) {
+	var res []T
+	err := ForEach(ctx, in, func(v T) error {
+		res = append(res, v)
+		return nil
+	})
+	return res, err
+}
+
+// ForEach calls fn for every value received from in and stops at the first error
+func ForEach[T any](ctx context.Context, in <-chan T, fn func(T) error) error {
+	for {
+		select {
+		case v, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if err := fn(v); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ToWriter encodes every value received from in and writes it to w, it stops at the first error
+func ToWriter[T any](ctx context.Context, in <-chan T, w io.Writer, encode func(T) ([]byte, error)) error {
+	return ForEach(ctx, in, func(v T) error {
+		b, err := encode(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	})
+}
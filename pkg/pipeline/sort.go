@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// EXTERNAL SORT
+// Sorting a stream means seeing every value before sending the first one, which doesn't fit in memory
+// when the stream is big. Sort keeps at most memLimit values: every time the buffer is full it's sorted
+// and spilled to a temporary file (a run), and once the input is closed the runs are k-way merged
+// with MergeSorted, reading one value per run at a time. The values are written with encoding/gob.
+
+// Sort sends the values received from in sorted by less keeping at most memLimit of them in memory,
+// T must be encodable with encoding/gob, the temporary files are removed when the stage ends,
+// an error (writing or reading a run) stops the stage and is sent to the second channel
+func Sort[T any](ctx context.Context, in <-chan T, less func(a, b T) bool, memLimit int) (<-chan T, <-chan error) {
+	out := make(chan T)
+	errc := make(chan error, 1)
+	memLimit = max(memLimit, 1)
+	cmp := func(a, b T) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	}
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		var runs []*os.File
+		defer func() {
+			for _, f := range runs {
+				f.Close()
+				os.Remove(f.Name())
+			}
+		}()
+
+		// SPILL a sorted run every time the buffer is full
+		buf := make([]T, 0, memLimit)
+		for v := range OrDone(ctx, in) {
+			buf = append(buf, v)
+			if len(buf) < memLimit {
+				continue
+			}
+			slices.SortFunc(buf, cmp)
+			f, err := spill(buf)
+			if f != nil {
+				runs = append(runs, f)
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			buf = buf[:0]
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slices.SortFunc(buf, cmp)
+
+		// K-WAY MERGE of the runs and what is left in memory
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		errs := &errOnce{cancel: cancel}
+		channels := []<-chan T{Generate(ctx, buf...)}
+		for _, f := range runs {
+			channels = append(channels, readRun[T](ctx, f, errs))
+		}
+		for v := range MergeSorted(ctx, less, channels...) {
+			if !send(ctx, out, v) {
+				break
+			}
+		}
+		if err := errs.get(); err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
+
+// spill writes the values to a new temporary file, the file is returned even on error so it can be removed
+func spill[T any](values []T) (*os.File, error) {
+	f, err := os.CreateTemp("", "pipeline-sort-*")
+	if err != nil {
+		return nil, fmt.Errorf("pipeline: sort: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			return f, fmt.Errorf("pipeline: sort: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return f, fmt.Errorf("pipeline: sort: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return f, fmt.Errorf("pipeline: sort: %w", err)
+	}
+	return f, nil
+}
+
+// readRun sends the values of a run, a read error is reported to errs (which cancels the merge)
+func readRun[T any](ctx context.Context, f *os.File, errs *errOnce) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		dec := gob.NewDecoder(bufio.NewReader(f))
+		for {
+			var v T
+			if err := dec.Decode(&v); err != nil {
+				if !errors.Is(err, io.EOF) {
+					errs.set(fmt.Errorf("pipeline: sort: %w", err))
+				}
+				return
+			}
+			if !send(ctx, out, v) {
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// GENERIC STAGES
+// The functions above only work with channels of integers.
+// With type parameters the same building blocks can be written once and reused for any type
+// (structs, strings, byte slices...), the stage body stays exactly the same.
+
+// Stage is the shape shared by every stage of a pipeline,
+// it receives values from upstream and returns the channel where its results are sent
+type Stage[In, Out any] func(ctx context.Context, in <-chan In) <-chan Out
+
+// Generate is the generic version of generate, it converts a list of values into a channel which emits them
+func Generate[T any](ctx context.Context, values ...T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for _, v := range values {
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Lift turns a plain function into a stage that applies it to every value received from upstream
+func Lift[In, Out any](fn func(In) Out) Stage[In, Out] {
+	return func(ctx context.Context, in <-chan In) <-chan Out {
+		out := make(chan Out)
+		go func() {
+			defer close(out)
+			for v := range in {
+				select {
+				case out <- fn(v):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out
+	}
+}
+
+// Then connects two stages, the output of the first one becomes the input of the second one
+func Then[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(ctx context.Context, in <-chan A) <-chan C {
+		return second(ctx, first(ctx, in))
+	}
+}
+
+// Merge is the generic version of merge, it multiplexes the input channels onto a single channel
+// that's closed when all the inputs are closed
+func Merge[T any](ctx context.Context, channels ...<-chan T) <-chan T {
+	var wg sync.WaitGroup
+	out := make(chan T)
+
+	send := func(ch <-chan T) {
+		defer wg.Done()
+		for v := range ch {
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	wg.Add(len(channels))
+	for _, ch := range channels {
+		go send(ch)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
@@ -0,0 +1,102 @@
+package pipeline
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/shardmap"
+)
+
+// STATEFUL STAGES
+// Running counts, deduplication sets or sessions need state that survives from one value to the next.
+// Sharing a map between workers means locking on every value, instead values are partitioned by key
+// and every shard is owned by a single goroutine, so the state of a key is only touched by one goroutine.
+
+// StatefulStage keeps a state of type S for every key of type K seen in the stream
+type StatefulStage[K comparable, S, In, Out any] struct {
+	key    func(In) K
+	fn     func(key K, state S, v In) (S, Out)
+	seed   maphash.Seed
+	shards []*stateShard[K, S]
+}
+
+type stateShard[K comparable, S any] struct {
+	mu     sync.Mutex // only contended by Snapshot and Restore
+	states map[K]S
+}
+
+// NewStatefulStage creates a stage with the given number of shards, fn receives the current state of the key
+// (the zero value for a new key) and returns the new state together with the value sent downstream
+func NewStatefulStage[K comparable, S, In, Out any](key func(In) K, fn func(key K, state S, v In) (S, Out), shards int) *StatefulStage[K, S, In, Out] {
+	s := &StatefulStage[K, S, In, Out]{key: key, fn: fn, seed: maphash.MakeSeed(), shards: make([]*stateShard[K, S], max(shards, 1))}
+	for i := range s.shards {
+		s.shards[i] = &stateShard[K, S]{states: make(map[K]S)}
+	}
+	return s
+}
+
+// Run starts one goroutine per shard, the values of a key are processed in order (the method value is a Stage)
+func (s *StatefulStage[K, S, In, Out]) Run(ctx context.Context, in <-chan In) <-chan Out {
+	parts := partition(ctx, in, func(v In) int {
+		return s.shard(s.key(v))
+	}, len(s.shards))
+
+	outs := make([]<-chan Out, len(parts))
+	for i, part := range parts {
+		outs[i] = s.runShard(ctx, s.shards[i], part)
+	}
+	return Merge(ctx, outs...)
+}
+
+func (s *StatefulStage[K, S, In, Out]) runShard(ctx context.Context, sh *stateShard[K, S], in <-chan In) <-chan Out {
+	out := make(chan Out)
+	go func() {
+		defer close(out)
+		for v := range in {
+			k := s.key(v)
+			sh.mu.Lock()
+			state, res := s.fn(k, sh.states[k], v)
+			sh.states[k] = state
+			sh.mu.Unlock()
+			if !send(ctx, out, res) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Snapshot returns a copy of the state of every key, each shard is copied atomically
+// but the shards are copied one after the other
+func (s *StatefulStage[K, S, In, Out]) Snapshot() map[K]S {
+	snap := make(map[K]S)
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for k, st := range sh.states {
+			snap[k] = st
+		}
+		sh.mu.Unlock()
+	}
+	return snap
+}
+
+// Restore replaces the state of every key with the given snapshot, usually before Run
+func (s *StatefulStage[K, S, In, Out]) Restore(snap map[K]S) {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		sh.states = make(map[K]S)
+		sh.mu.Unlock()
+	}
+	for k, st := range snap {
+		sh := s.shards[s.shard(k)]
+		sh.mu.Lock()
+		sh.states[k] = st
+		sh.mu.Unlock()
+	}
+}
+
+// shard returns the index of the shard of the key, the key is hashed like the keys of a shardmap
+func (s *StatefulStage[K, S, In, Out]) shard(k K) int {
+	return int(shardmap.Hash(s.seed, k) % uint64(len(s.shards)))
+}
@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+)
+
+// ROLLING STATISTICS
+// A pipeline in production is a black box unless something looks at the data flowing through it:
+// how many values per second, how big they are, how slow the slowest ones are. Stats lets every value
+// through untouched and keeps the ones that arrived during the last window, every so often it computes
+// a snapshot (count, rate, mean, percentiles) of a number extracted from them and sends it on a side channel.
+
+// Snapshot are the statistics of the values received during a window
+type Snapshot struct {
+	At    time.Time // when the snapshot was taken, the window is [At-window, At]
+	Count int
+	Rate  float64 // values per second
+	Mean  float64
+	Min   float64
+	Max   float64
+	P50   float64
+	P95   float64
+	P99   float64
+}
+
+// DefaultStatsWindow is the window of Stats when the one given is not positive
+const DefaultStatsWindow = time.Minute
+
+// Stats forwards every value received from in and sends a snapshot of the numbers extracted by value
+// from the values of the last window once per window, or every WithInterval (and a last one when in is closed),
+// a snapshot is dropped if the second channel is not ready, so it doesn't need to be read, it accepts WithClock
+func Stats[T any](ctx context.Context, in <-chan T, window time.Duration, value func(T) float64, opts ...Option) (<-chan T, <-chan Snapshot) {
+	o := newStageOptions(opts)
+	if window <= 0 {
+		window = DefaultStatsWindow
+	}
+	every := o.interval
+	if every <= 0 {
+		every = window
+	}
+	out := make(chan T)
+	snapshots := make(chan Snapshot)
+	go func() {
+		defer close(out)
+		defer close(snapshots)
+		ticker := o.clock.NewTicker(every)
+		defer ticker.Stop()
+
+		var buf []timed[float64] // the numbers inside the window, oldest first
+		snapshot := func(now time.Time) {
+			start := now.Add(-window)
+			i := 0
+			for i < len(buf) && buf[i].at.Before(start) {
+				i++
+			}
+			buf = buf[i:]
+			select {
+			case snapshots <- summarize(now, window, buf):
+			default: // nobody is watching right now
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					snapshot(o.clock.Now())
+					return
+				}
+				buf = append(buf, timed[float64]{at: o.clock.Now(), v: value(v)})
+				if !send(ctx, out, v) {
+					return
+				}
+			case now := <-ticker.C():
+				snapshot(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, snapshots
+}
+
+// summarize computes the snapshot of the numbers of a window
+func summarize(now time.Time, window time.Duration, buf []timed[float64]) Snapshot {
+	s := Snapshot{At: now, Count: len(buf)}
+	if len(buf) == 0 {
+		return s
+	}
+	values := make([]float64, len(buf))
+	var sum float64
+	for i, t := range buf {
+		values[i] = t.v
+		sum += t.v
+	}
+	slices.Sort(values)
+	s.Rate = float64(len(values)) / window.Seconds()
+	s.Mean = sum / float64(len(values))
+	s.Min, s.Max = values[0], values[len(values)-1]
+	s.P50, s.P95, s.P99 = percentile(values, 50), percentile(values, 95), percentile(values, 99)
+	return s
+}
+
+// percentile returns the p-th percentile of sorted values (nearest rank)
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
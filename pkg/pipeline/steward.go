@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// STEWARD
+// Recover keeps a panic from crashing the process, but the stage still stops.
+// A steward owns the channels of the stage and runs the goroutine that does the work (the ward),
+// when the ward dies (an error, a panic, a call that never returns) the steward starts a new one
+// reading from the same input and sending to the same output, so the rest of the pipeline never notices.
+// The value the ward was working on when it died is lost.
+
+// ErrTooManyRestarts is sent by Steward when the ward dies more times than the config allows
+var ErrTooManyRestarts = errors.New("pipeline: too many restarts")
+
+// StewardConfig configures Steward
+type StewardConfig struct {
+	MaxRestarts int                           // restarts before giving up, zero means no limit
+	Backoff     RetryPolicy                   // wait before every restart, only the backoff fields are used
+	Timeout     time.Duration                 // a call to fn taking longer is considered stuck, zero means no limit
+	OnRestart   func(restarts int, err error) // called before every restart with the reason the ward died, can be nil
+}
+
+// Steward applies fn to every value received from in and restarts the ward goroutine when it dies,
+// once it gives up the reason is sent to the second channel and both channels are closed
+func Steward[In, Out any](ctx context.Context, in <-chan In, fn func(context.Context, In) (Out, error), cfg StewardConfig) (<-chan Out, <-chan error) {
+	out := make(chan Out)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errc)
+		for restarts := 0; ; restarts++ {
+			err := ward(ctx, in, out, fn, cfg.Timeout)
+			if err == nil || ctx.Err() != nil {
+				return // the input is exhausted or the pipeline is cancelled
+			}
+			if cfg.MaxRestarts > 0 && restarts == cfg.MaxRestarts {
+				errc <- fmt.Errorf("%w: %w", ErrTooManyRestarts, err)
+				return
+			}
+			if cfg.OnRestart != nil {
+				cfg.OnRestart(restarts+1, err)
+			}
+			if !sleep(ctx, cfg.Backoff.backoff(restarts+1)) {
+				return
+			}
+		}
+	}()
+	return out, errc
+}
+
+// ward runs the worker goroutine until the input is closed (nil) or it dies (the reason),
+// a worker stuck in fn for longer than timeout is abandoned
+func ward[In, Out any](ctx context.Context, in <-chan In, out chan<- Out, fn func(context.Context, In) (Out, error), timeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // tells an abandoned worker to exit as soon as it can
+
+	busy := make(chan bool) // the pulses of the worker: true when a call starts, false when it returns
+	done := make(chan error, 1)
+	go func() {
+		done <- work(ctx, in, out, fn, busy)
+	}()
+
+	var stuck <-chan time.Time
+	for {
+		select {
+		case b := <-busy:
+			stuck = nil
+			if b && timeout > 0 {
+				stuck = time.After(timeout)
+			}
+		case err := <-done:
+			return err
+		case <-stuck:
+			return fmt.Errorf("%w: no result after %v", ErrStalled, timeout)
+		}
+	}
+}
+
+// work is the body of the worker goroutine, a panic is returned as a *PanicError
+func work[In, Out any](ctx context.Context, in <-chan In, out chan<- Out, fn func(context.Context, In) (Out, error), busy chan<- bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	for {
+		select {
+		case v, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if !send(ctx, busy, true) {
+				return nil
+			}
+			res, err := fn(ctx, v)
+			if !send(ctx, busy, false) {
+				return nil // abandoned, the result is dropped
+			}
+			if err != nil {
+				return err
+			}
+			if !send(ctx, out, res) {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// STREAM ADAPTERS
+// A gRPC stream is a channel in disguise: Recv blocks until the next message, Send until there's room.
+// The adapters below turn a server-streaming client into a source and feed a client-streaming call
+// from a pipeline. They only depend on the methods of the generated stream types
+// (grpc.ServerStreamingClient and grpc.ClientStreamingClient satisfy them), not on the grpc package.
+// Recv and Send don't take a context: the stream must be opened with the pipeline context,
+// so cancelling it aborts the call and unblocks them.
+
+// StreamReceiver is the receiving side of a stream, Recv returns io.EOF when the stream is over
+type StreamReceiver[T any] interface {
+	Recv() (T, error)
+}
+
+// StreamSender is the sending side of a client stream, CloseAndRecv closes it and waits for the response
+type StreamSender[T, R any] interface {
+	Send(T) error
+	CloseAndRecv() (R, error)
+}
+
+// FromStream sends every message received from the stream until it returns io.EOF,
+// any other error is sent to the second channel and both channels are closed
+func FromStream[T any](ctx context.Context, s StreamReceiver[T]) (<-chan T, <-chan error) {
+	out := make(chan T)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(out)
+		defer close(errc)
+		for {
+			msg, err := s.Recv()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					errc <- err // a cancelled stream is not an error of the stream
+				}
+				return
+			}
+			if !send(ctx, out, msg) {
+				return
+			}
+		}
+	}()
+	return out, errc
+}
+
+// ToStream sends every value received from in on the stream and returns the response once in is closed,
+// if the context is done first the stream is left to be aborted by its context and the context error is returned
+func ToStream[T, R any](ctx context.Context, in <-chan T, s StreamSender[T, R]) (R, error) {
+	var zero R
+	err := ForEach(ctx, in, func(v T) error {
+		return s.Send(v)
+	})
+	if errors.Is(err, io.EOF) {
+		// the server ended the stream, the reason is returned by CloseAndRecv
+		_, err = s.CloseAndRecv()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return zero, err
+	}
+	if err != nil {
+		return zero, err
+	}
+	return s.CloseAndRecv()
+}
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+)
+
+// EARLY EXIT
+// A sink that only needs the first n values leaves the upstream goroutines blocked on their sends
+// until somebody cancels their context. Take owns that context: the upstream stages are built
+// with a context derived from ctx, which is cancelled as soon as the n-th value is read.
+
+// ErrTakeDone is the cause of the cancellation of the upstream stages of Take once it has read its values
+var ErrTakeDone = errors.New("pipeline: take: done")
+
+// Take builds the upstream stages with a derived context, forwards the first n values and cancels the rest of the work,
+// the returned channel is closed only after the upstream channel is closed, so no upstream goroutine is left behind
+func Take[T any](ctx context.Context, src SourceFunc[T], n int) <-chan T {
+	ctx, cancel := context.WithCancelCause(ctx)
+	in := src(ctx)
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		take(ctx, in, out, n)
+		cancel(ErrTakeDone) // UPSTREAM CANCELLATION
+
+		// wait for the upstream stages to exit
+		for range in {
+		}
+	}()
+	return out
+}
+
+func take[T any](ctx context.Context, in <-chan T, out chan<- T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case v, ok := <-in:
+			if !ok {
+				return
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
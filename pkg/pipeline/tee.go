@@ -0,0 +1,37 @@
+package pipeline
+
+import "context"
+
+// TEE
+// Fan-out splits the work: every value goes to exactly one worker.
+// Tee copies the work: every value goes to every output, like the tee command in a shell.
+// With Block (the default) the slowest consumer sets the pace for everybody,
+// WithBuffer gives each consumer some slack and the drop policies skip values for the consumers that fall behind.
+
+// Tee returns n channels which receive every value received from in,
+// it accepts WithBuffer and WithOverflow
+func Tee[T any](ctx context.Context, in <-chan T, n int, opts ...Option) []<-chan T {
+	o := newStageOptions(opts)
+	outs := make([]chan T, max(n, 1))
+	res := make([]<-chan T, len(outs))
+	for i := range outs {
+		outs[i] = make(chan T, o.buffer)
+		res[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		for v := range in {
+			for _, out := range outs {
+				if sent, _ := offer(ctx, out, v, o.overflow); !sent {
+					return
+				}
+			}
+		}
+	}()
+	return res
+}
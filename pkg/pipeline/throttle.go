@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// THROTTLING
+// Token bucket: the bucket holds up to burst tokens and is refilled at ratePerSecond,
+// every value takes one token and waits when the bucket is empty.
+// Short bursts flow at full speed, sustained traffic is bounded by the rate.
+
+// Throttle forwards the values received from in at most ratePerSecond values per second,
+// allowing bursts of up to burst values, a non-positive rate disables the limit, it accepts WithClock
+func Throttle[T any](ctx context.Context, in <-chan T, ratePerSecond float64, burst int, opts ...Option) <-chan T {
+	o := newStageOptions(opts)
+	if burst < 1 {
+		burst = 1
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		tokens := float64(burst)
+		last := o.clock.Now()
+		for v := range in {
+			if ratePerSecond > 0 {
+				now := o.clock.Now()
+				tokens = min(float64(burst), tokens+now.Sub(last).Seconds()*ratePerSecond)
+				last = now
+				if tokens < 1 {
+					wait := time.Duration((1 - tokens) / ratePerSecond * float64(time.Second))
+					timer := o.clock.NewTimer(wait)
+					select {
+					case <-timer.C():
+					case <-ctx.Done():
+						timer.Stop()
+						return
+					}
+					tokens, last = 1, o.clock.Now()
+				}
+				tokens--
+			}
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
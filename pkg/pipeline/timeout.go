@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// TIMEOUT PER ITEM
+// A single slow value (a hung connection, a huge payload) stalls the whole stage and everything behind it.
+// Each value gets its own deadline: when it's exceeded the value goes to the dead-letter channel
+// and the stage moves on to the next one.
+
+// ItemTimeout applies fn to every value received from in with a context that expires after d,
+// values that fail or exceed the deadline are sent to the second channel, both channels must be read
+func ItemTimeout[In, Out any](ctx context.Context, in <-chan In, fn func(context.Context, In) (Out, error), d time.Duration) (<-chan Out, <-chan Failed[In]) {
+	out := make(chan Out)
+	dead := make(chan Failed[In])
+	go func() {
+		defer close(out)
+		defer close(dead)
+		for v := range in {
+			res, err := callWithTimeout(ctx, v, fn, d)
+			if err != nil {
+				if !send(ctx, dead, Failed[In]{Value: v, Err: err, Attempts: 1}) {
+					return
+				}
+				continue
+			}
+			if !send(ctx, out, res) {
+				return
+			}
+		}
+	}()
+	return out, dead
+}
+
+// callWithTimeout runs fn in its own goroutine so a function that ignores its context can't stall the caller
+func callWithTimeout[In, Out any](ctx context.Context, v In, fn func(context.Context, In) (Out, error), d time.Duration) (Out, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	type result struct {
+		v   Out
+		err error
+	}
+	done := make(chan result, 1) // buffered, the goroutine never blocks even if nobody reads it
+	go func() {
+		res, err := fn(ctx, v)
+		done <- result{res, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		var zero Out
+		return zero, ctx.Err()
+	}
+}
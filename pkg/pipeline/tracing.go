@@ -0,0 +1,40 @@
+package pipeline
+
+import "context"
+
+// TRACING
+// Metrics tell which stage is slow, traces tell where a single value spent its time.
+// Every stage opens a span for its whole life and a child span for every value it processes.
+// The interfaces are the subset of OpenTelemetry the pipeline needs, an adapter around
+// an OpenTelemetry tracer is a few lines and keeps the dependency out of this package.
+
+// Tracer starts spans, the returned context carries the new span
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a traced operation
+type Span interface {
+	RecordError(err error)
+	End()
+}
+
+// Tracer sets the tracer used to trace every stage and every value
+func (p *Pipeline[T]) Tracer(t Tracer) *Pipeline[T] {
+	p.tracer = t
+	return p
+}
+
+// Traced wraps a function so every call runs inside its own span, child of the span found in the context.
+// With envelopes, the context of the value carries its trace from stage to stage.
+func Traced[In, Out any](t Tracer, name string, fn func(context.Context, In) (Out, error)) func(context.Context, In) (Out, error) {
+	return func(ctx context.Context, v In) (Out, error) {
+		ctx, span := t.Start(ctx, name)
+		defer span.End()
+		res, err := fn(ctx, v)
+		if err != nil {
+			span.RecordError(err)
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+)
+
+// WINDOWS
+// Streams never end, so aggregations (counts, averages...) are computed over windows of time.
+// Tumbling windows are fixed size and don't overlap, sliding windows are fixed size and overlap
+// (a new window starts every slide), session windows stay open while values keep arriving
+// and close after a gap without activity. Values belong to a window by their arrival time.
+
+// Window is a group of values that arrived between Start and End
+type Window[T any] struct {
+	Start time.Time
+	End   time.Time
+	Items []T
+}
+
+// timed is a value together with its arrival time
+type timed[T any] struct {
+	at time.Time
+	v  T
+}
+
+// TumblingWindow groups the values received from in into consecutive windows of the given size,
+// empty windows are not sent, it accepts WithClock
+func TumblingWindow[T any](ctx context.Context, in <-chan T, size time.Duration, opts ...Option) <-chan Window[T] {
+	o := newStageOptions(opts)
+	out := make(chan Window[T])
+	go func() {
+		defer close(out)
+		ticker := o.clock.NewTicker(size)
+		defer ticker.Stop()
+
+		w := Window[T]{Start: o.clock.Now()}
+		emit := func(end time.Time) bool {
+			w.End = end
+			if len(w.Items) > 0 {
+				select {
+				case out <- w:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			w = Window[T]{Start: end}
+			return true
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					emit(o.clock.Now())
+					return
+				}
+				w.Items = append(w.Items, v)
+			case now := <-ticker.C():
+				if !emit(now) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// SlidingWindow sends every slide the values received from in during the last size,
+// a value belongs to size/slide windows, empty windows are not sent, it accepts WithClock
+func SlidingWindow[T any](ctx context.Context, in <-chan T, size, slide time.Duration, opts ...Option) <-chan Window[T] {
+	o := newStageOptions(opts)
+	out := make(chan Window[T])
+	go func() {
+		defer close(out)
+		ticker := o.clock.NewTicker(slide)
+		defer ticker.Stop()
+
+		var buf []timed[T] // values still inside the last window, oldest first
+		emit := func(end time.Time) bool {
+			start := end.Add(-size)
+			for len(buf) > 0 && buf[0].at.Before(start) {
+				buf = buf[1:]
+			}
+			if len(buf) == 0 {
+				return true
+			}
+			w := Window[T]{Start: start, End: end, Items: make([]T, len(buf))}
+			for i, t := range buf {
+				w.Items[i] = t.v
+			}
+			select {
+			case out <- w:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					emit(o.clock.Now())
+					return
+				}
+				buf = append(buf, timed[T]{at: o.clock.Now(), v: v})
+			case now := <-ticker.C():
+				if !emit(now) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// SessionWindow groups the values received from in into sessions,
+// a session is sent when no value has arrived for the given gap, it accepts WithClock
+func SessionWindow[T any](ctx context.Context, in <-chan T, gap time.Duration, opts ...Option) <-chan Window[T] {
+	o := newStageOptions(opts)
+	out := make(chan Window[T])
+	go func() {
+		defer close(out)
+		timer := o.clock.NewTimer(gap)
+		stopTimer(timer)
+		defer timer.Stop()
+
+		var w Window[T]
+		emit := func() bool {
+			if len(w.Items) == 0 {
+				return true
+			}
+			select {
+			case out <- w:
+				w = Window[T]{}
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					emit()
+					return
+				}
+				now := o.clock.Now()
+				if len(w.Items) == 0 {
+					w.Start = now
+				}
+				w.End = now
+				w.Items = append(w.Items, v)
+				stopTimer(timer)
+				timer.Reset(gap)
+			case <-timer.C():
+				if !emit() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,254 @@
+package pubsub
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// PARTITIONED LOG
+// The broker forgets a message once it's delivered and every subscriber gets every message.
+// A log keeps the messages: it's split in partitions (the key of a message decides its partition,
+// so messages with the same key keep their order) and every message has an offset in its partition.
+// Consumers in the same group share the work: every partition is read by a single member of the group,
+// when members join or leave the partitions are assigned again (rebalance) and the new owner of a partition
+// continues from the last offset committed by the group, so uncommitted messages are delivered again.
+
+// Record is a message stored in the log
+type Record[T any] struct {
+	Partition int
+	Offset    int64
+	Key       string
+	Value     T
+}
+
+// Log is an in-memory partitioned log read by consumer groups
+type Log[T any] struct {
+	ctx    context.Context // cancelled by Close, stops every reader
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	partitions [][]Record[T]
+	notify     chan struct{} // closed and replaced on every append
+	groups     map[string]*group[T]
+	next       int // partition of the next message without key
+}
+
+// NewLog creates an empty log with the given number of partitions
+func NewLog[T any](partitions int) *Log[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Log[T]{
+		ctx:        ctx,
+		cancel:     cancel,
+		partitions: make([][]Record[T], max(partitions, 1)),
+		notify:     make(chan struct{}),
+		groups:     make(map[string]*group[T]),
+	}
+}
+
+// Partitions returns the number of partitions of the log
+func (l *Log[T]) Partitions() int {
+	return len(l.partitions)
+}
+
+// Append adds a message to the partition of its key (messages without key are spread in turns) and returns its record
+func (l *Log[T]) Append(key string, v T) Record[T] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var p int
+	if key == "" {
+		p = l.next
+		l.next = (l.next + 1) % len(l.partitions)
+	} else {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(key))
+		p = int(h.Sum32() % uint32(len(l.partitions)))
+	}
+	r := Record[T]{Partition: p, Offset: int64(len(l.partitions[p])), Key: key, Value: v}
+	l.partitions[p] = append(l.partitions[p], r)
+
+	// wake up the readers waiting for new messages
+	close(l.notify)
+	l.notify = make(chan struct{})
+	return r
+}
+
+// Close stops every consumer and closes their channels
+func (l *Log[T]) Close() {
+	l.cancel()
+	l.mu.Lock()
+	groups := l.groups
+	l.groups = make(map[string]*group[T])
+	l.mu.Unlock()
+	for _, g := range groups {
+		g.close()
+	}
+}
+
+// Subscribe joins the consumer group, the consumer leaves it when the context is done or the log is closed
+func (l *Log[T]) Subscribe(ctx context.Context, groupName string) *Consumer[T] {
+	c := &Consumer[T]{ch: make(chan Record[T])}
+	l.mu.Lock()
+	if l.ctx.Err() != nil {
+		l.mu.Unlock()
+		close(c.ch)
+		return c
+	}
+	g, ok := l.groups[groupName]
+	if !ok {
+		g = &group[T]{log: l, committed: make([]int64, len(l.partitions))}
+		l.groups[groupName] = g
+	}
+	l.mu.Unlock()
+
+	c.group = g
+	g.join(c)
+	go func() {
+		select {
+		case <-ctx.Done():
+			g.leave(c)
+		case <-l.ctx.Done(): // Close takes care of it
+		}
+	}()
+	return c
+}
+
+// read sends the records of the partition starting at offset until the context is done
+func (l *Log[T]) read(ctx context.Context, p int, offset int64, out chan<- Record[T]) {
+	for {
+		l.mu.Lock()
+		recs, notify := l.partitions[p], l.notify
+		l.mu.Unlock()
+		for ; offset < int64(len(recs)); offset++ {
+			select {
+			case out <- recs[offset]:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Consumer is a member of a consumer group
+type Consumer[T any] struct {
+	group *group[T]
+	ch    chan Record[T]
+
+	partitions []int // guarded by the group lock
+}
+
+// Records returns the channel receiving the records of the partitions assigned to the consumer,
+// it's closed when the consumer leaves the group
+func (c *Consumer[T]) Records() <-chan Record[T] {
+	return c.ch
+}
+
+// Commit records that the group is done with the record and every record before it in its partition
+func (c *Consumer[T]) Commit(r Record[T]) {
+	if c.group == nil {
+		return
+	}
+	c.group.commit(r)
+}
+
+// Partitions returns the partitions currently assigned to the consumer
+func (c *Consumer[T]) Partitions() []int {
+	if c.group == nil {
+		return nil
+	}
+	c.group.mu.Lock()
+	defer c.group.mu.Unlock()
+	return append([]int(nil), c.partitions...)
+}
+
+// group is a consumer group, the members share the partitions of the log
+type group[T any] struct {
+	log *Log[T]
+
+	mu        sync.Mutex
+	members   []*Consumer[T] // in join order
+	committed []int64        // next offset to read, by partition
+	closed    bool
+
+	stop    context.CancelFunc // stops the readers of the current assignment
+	readers sync.WaitGroup
+}
+
+func (g *group[T]) join(c *Consumer[T]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		close(c.ch)
+		return
+	}
+	g.members = append(g.members, c)
+	g.rebalance()
+}
+
+func (g *group[T]) leave(c *Consumer[T]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, m := range g.members {
+		if m == c {
+			g.members = append(g.members[:i], g.members[i+1:]...)
+			g.rebalance() // stops the readers sending to c before its channel is closed
+			close(c.ch)
+			return
+		}
+	}
+}
+
+func (g *group[T]) commit(r Record[T]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.committed[r.Partition] = max(g.committed[r.Partition], r.Offset+1)
+}
+
+// rebalance stops every reader and assigns the partitions again, the group must be locked
+func (g *group[T]) rebalance() {
+	g.stopReaders()
+	for _, m := range g.members {
+		m.partitions = m.partitions[:0]
+	}
+	if len(g.members) == 0 {
+		return
+	}
+
+	ctx, stop := context.WithCancel(g.log.ctx)
+	g.stop = stop
+	for p, offset := range g.committed {
+		m := g.members[p%len(g.members)]
+		m.partitions = append(m.partitions, p)
+		g.readers.Add(1)
+		go func() {
+			defer g.readers.Done()
+			g.log.read(ctx, p, offset, m.ch)
+		}()
+	}
+}
+
+// stopReaders cancels the readers of the current assignment and waits for them, the group must be locked
+func (g *group[T]) stopReaders() {
+	if g.stop != nil {
+		g.stop()
+		g.readers.Wait()
+		g.stop = nil
+	}
+}
+
+// close stops the readers and closes the channel of every member
+func (g *group[T]) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	g.stopReaders()
+	for _, m := range g.members {
+		close(m.ch)
+	}
+	g.members = nil
+}
@@ -0,0 +1,117 @@
+package pubsub_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pipeline/pipelinetest"
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/pubsub"
+)
+
+// drain reads the records of the consumer until its channel is closed
+func drain[T any](c *pubsub.Consumer[T]) {
+	for range c.Records() {
+	}
+}
+
+func TestLogKeepsKeysInOrder(t *testing.T) {
+	l := pubsub.NewLog[int](4)
+	defer l.Close()
+
+	var last pubsub.Record[int]
+	for i := range 10 {
+		r := l.Append("user-1", i)
+		if i > 0 && (r.Partition != last.Partition || r.Offset != last.Offset+1) {
+			t.Fatalf("record %d: got partition %d offset %d after partition %d offset %d",
+				i, r.Partition, r.Offset, last.Partition, last.Offset)
+		}
+		last = r
+	}
+}
+
+func TestLogRebalance(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	l := pubsub.NewLog[int](4)
+	defer l.Close()
+
+	a := l.Subscribe(context.Background(), "g")
+	if got := a.Partitions(); !slices.Equal(got, []int{0, 1, 2, 3}) {
+		t.Fatalf("single member: got partitions %v, want all of them", got)
+	}
+
+	ctx, leave := context.WithCancel(context.Background())
+	b := l.Subscribe(ctx, "g")
+	pa, pb := a.Partitions(), b.Partitions()
+	if len(pa) != 2 || len(pb) != 2 {
+		t.Fatalf("two members: got partitions %v and %v, want two each", pa, pb)
+	}
+	all := append(slices.Clone(pa), pb...)
+	slices.Sort(all)
+	if !slices.Equal(all, []int{0, 1, 2, 3}) {
+		t.Fatalf("two members: got partitions %v and %v, want every partition once", pa, pb)
+	}
+
+	leave()
+	drain(b) // closed once b has left the group
+	if got := a.Partitions(); !slices.Equal(got, []int{0, 1, 2, 3}) {
+		t.Fatalf("after b left: got partitions %v, want all of them", got)
+	}
+
+	// another group reads the log on its own
+	other := l.Subscribe(context.Background(), "other")
+	if got := other.Partitions(); len(got) != 4 {
+		t.Fatalf("other group: got partitions %v, want all of them", got)
+	}
+}
+
+func TestLogRedeliversUncommitted(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	l := pubsub.NewLog[int](1)
+	defer l.Close()
+	for i := range 5 {
+		l.Append("", i)
+	}
+
+	ctx, leave := context.WithCancel(context.Background())
+	a := l.Subscribe(ctx, "g")
+	for i := range 3 {
+		r := <-a.Records()
+		if r.Value != i {
+			t.Fatalf("got %d, want %d", r.Value, i)
+		}
+		if i == 1 {
+			a.Commit(r) // records 0 and 1 are done, 2 is not
+		}
+	}
+	leave()
+	drain(a)
+
+	b := l.Subscribe(context.Background(), "g")
+	for want := 2; want < 5; want++ {
+		r := <-b.Records()
+		if r.Value != want || r.Offset != int64(want) {
+			t.Fatalf("got value %d at offset %d, want %d", r.Value, r.Offset, want)
+		}
+	}
+
+	// new records reach the consumer while it waits
+	l.Append("", 5)
+	if r := <-b.Records(); r.Value != 5 {
+		t.Fatalf("got %d, want 5", r.Value)
+	}
+}
+
+func TestLogCloseClosesConsumers(t *testing.T) {
+	pipelinetest.CheckLeaks(t)
+	l := pubsub.NewLog[int](2)
+	a := l.Subscribe(context.Background(), "g")
+	b := l.Subscribe(context.Background(), "g")
+	l.Close()
+	drain(a)
+	drain(b)
+
+	if _, ok := <-l.Subscribe(context.Background(), "g").Records(); ok {
+		t.Error("a consumer of a closed log got a record")
+	}
+}
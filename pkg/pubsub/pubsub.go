@@ -0,0 +1,149 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// PUB/SUB
+// merge joins many producers into one consumer, tee copies one producer to many consumers.
+// A broker does both at runtime: producers publish on a topic without knowing who is listening
+// and consumers come and go by subscribing with a context, the subscription ends when the context is done.
+
+// DefaultBuffer is the size of a subscriber's channel when WithBuffer is not used
+const DefaultBuffer = 16
+
+// Option configures a broker
+type Option func(*config)
+
+type config struct {
+	buffer int
+}
+
+// WithBuffer sets the size of every subscriber's channel,
+// a subscriber that falls behind by more than that misses messages
+func WithBuffer(n int) Option {
+	return func(c *config) {
+		if n >= 0 {
+			c.buffer = n
+		}
+	}
+}
+
+// Broker delivers the messages published on a topic to every subscriber of that topic
+type Broker[T any] struct {
+	cfg config
+
+	mu     sync.RWMutex
+	topics map[string]map[chan T]struct{}
+	closed bool
+	done   chan struct{}
+
+	dropped atomic.Int64
+}
+
+// New creates a broker with no topics
+func New[T any](opts ...Option) *Broker[T] {
+	cfg := config{buffer: DefaultBuffer}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Broker[T]{
+		cfg:    cfg,
+		topics: make(map[string]map[chan T]struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving the messages published on the topic from now on,
+// the channel is closed when the context is done or the broker is closed
+func (b *Broker[T]) Subscribe(ctx context.Context, topic string) <-chan T {
+	ch := make(chan T, b.cfg.buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[chan T]struct{})
+		b.topics[topic] = subs
+	}
+	subs[ch] = struct{}{}
+
+	// AUTOMATIC CLEANUP
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.unsubscribe(topic, ch)
+		case <-b.done: // Close already closed the channel
+		}
+	}()
+	return ch
+}
+
+func (b *Broker[T]) unsubscribe(topic string, ch chan T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs, ok := b.topics[topic]
+	if !ok {
+		return
+	}
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	if len(subs) == 0 {
+		delete(b.topics, topic)
+	}
+	close(ch)
+}
+
+// Publish sends the message to every subscriber of the topic without blocking,
+// it returns the number of subscribers that received it (the others were not keeping up)
+func (b *Broker[T]) Publish(topic string, msg T) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var delivered int
+	for ch := range b.topics[topic] {
+		select {
+		case ch <- msg:
+			delivered++
+		default:
+			b.dropped.Add(1)
+		}
+	}
+	return delivered
+}
+
+// Subscribers returns the number of active subscriptions to the topic
+func (b *Broker[T]) Subscribers(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic])
+}
+
+// Dropped returns the number of messages that could not be delivered because a subscriber's buffer was full
+func (b *Broker[T]) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// Close closes every subscription, later subscriptions receive an already closed channel
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+	for topic, subs := range b.topics {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(b.topics, topic)
+	}
+}
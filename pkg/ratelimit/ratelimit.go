@@ -0,0 +1,226 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/clock"
+)
+
+// RATE LIMITING
+// Throttle limits a single channel, but a limit usually belongs to a resource (an API, a database)
+// shared by many goroutines. The limiters below are safe for concurrent use and share one interface:
+// Allow answers right away, Wait blocks until the call is allowed or the context is done.
+// They differ in how they treat bursts:
+// - token bucket: bursts of up to burst calls, then the rate
+// - leaky bucket: no bursts, calls are spaced evenly and at most capacity calls wait in line
+// - sliding window: at most limit calls in any window of time
+// Like Throttle, a non-positive rate (or window) means no limit: every call is allowed right away.
+
+// ErrLimitExceeded is returned by Wait when the call would have to wait longer than the limiter allows
+var ErrLimitExceeded = errors.New("ratelimit: limit exceeded")
+
+// Limiter decides whether a call can proceed now
+type Limiter interface {
+	// Allow reports whether a call can proceed now, if it returns true the call is counted
+	Allow() bool
+	// Wait blocks until a call can proceed, it returns an error if the context is done first
+	Wait(ctx context.Context) error
+}
+
+// Option configures a limiter
+type Option func(*options)
+
+type options struct {
+	clock clock.Clock
+}
+
+// WithClock sets the clock used by the limiter, clock.Real by default
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: clock.Real}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// wait calls try until it returns zero (the call was allowed), sleeping for the time try asks for
+func wait(ctx context.Context, c clock.Clock, try func() time.Duration) error {
+	for {
+		d := try()
+		if d <= 0 {
+			return nil
+		}
+		timer := c.NewTimer(d)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// TokenBucket holds up to burst tokens refilled at rate tokens per second, every call takes one token
+type TokenBucket struct {
+	rate  float64
+	burst float64
+	clock clock.Clock
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full token bucket
+func NewTokenBucket(rate float64, burst int, opts ...Option) *TokenBucket {
+	o := newOptions(opts)
+	b := float64(max(burst, 1))
+	return &TokenBucket{rate: rate, burst: b, clock: o.clock, tokens: b, last: o.clock.Now()}
+}
+
+// Allow takes a token if there is one
+func (b *TokenBucket) Allow() bool {
+	return b.try() == 0
+}
+
+// Wait blocks until a token is available and takes it
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return wait(ctx, b.clock, b.try)
+}
+
+// try takes a token or returns how long until the next one
+func (b *TokenBucket) try() time.Duration {
+	if b.rate <= 0 {
+		return 0 // no limit
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return max(time.Duration((1-b.tokens)/b.rate*float64(time.Second)), time.Nanosecond)
+}
+
+// LeakyBucket lets calls through at a steady rate, one every 1/rate seconds,
+// up to capacity calls can be waiting for their turn
+type LeakyBucket struct {
+	interval time.Duration
+	capacity int
+	clock    clock.Clock
+
+	mu   sync.Mutex
+	next time.Time // when the next call can proceed
+}
+
+// NewLeakyBucket creates a leaky bucket that lets through rate calls per second
+func NewLeakyBucket(rate float64, capacity int, opts ...Option) *LeakyBucket {
+	o := newOptions(opts)
+	var interval time.Duration // no wait between calls
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+	return &LeakyBucket{
+		interval: interval,
+		capacity: max(capacity, 0),
+		clock:    o.clock,
+	}
+}
+
+// Allow reports whether it's the turn of a new call
+func (b *LeakyBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	if now.Before(b.next) {
+		return false
+	}
+	b.next = now.Add(b.interval)
+	return true
+}
+
+// Wait books the next turn and blocks until it comes,
+// it returns ErrLimitExceeded right away if capacity calls are already waiting
+func (b *LeakyBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := b.clock.Now()
+	at := b.next
+	if at.Before(now) {
+		at = now
+	}
+	if at.Sub(now) > time.Duration(b.capacity)*b.interval {
+		b.mu.Unlock()
+		return ErrLimitExceeded
+	}
+	b.next = at.Add(b.interval)
+	b.mu.Unlock()
+
+	if err := wait(ctx, b.clock, func() time.Duration { return at.Sub(b.clock.Now()) }); err != nil {
+		b.mu.Lock()
+		if b.next.Equal(at.Add(b.interval)) {
+			b.next = at // nobody booked after this call, give the turn back
+		}
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// SlidingWindow allows at most limit calls in any window of time,
+// it remembers the time of the last limit calls
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	clock  clock.Clock
+
+	mu    sync.Mutex
+	calls []time.Time // ring buffer of the last calls, oldest at head
+	head  int
+}
+
+// NewSlidingWindow creates a limiter that allows limit calls per window
+func NewSlidingWindow(limit int, window time.Duration, opts ...Option) *SlidingWindow {
+	o := newOptions(opts)
+	limit = max(limit, 1)
+	return &SlidingWindow{limit: limit, window: window, clock: o.clock, calls: make([]time.Time, 0, limit)}
+}
+
+// Allow counts the call if there were less than limit calls in the last window
+func (w *SlidingWindow) Allow() bool {
+	return w.try() == 0
+}
+
+// Wait blocks until the oldest call in the window expires
+func (w *SlidingWindow) Wait(ctx context.Context) error {
+	return wait(ctx, w.clock, w.try)
+}
+
+// try counts the call or returns how long until the oldest call leaves the window
+func (w *SlidingWindow) try() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.clock.Now()
+	if len(w.calls) < w.limit {
+		w.calls = append(w.calls, now)
+		return 0
+	}
+	oldest := w.calls[w.head]
+	if d := oldest.Add(w.window).Sub(now); d > 0 {
+		return d
+	}
+	w.calls[w.head] = now
+	w.head = (w.head + 1) % w.limit
+	return 0
+}
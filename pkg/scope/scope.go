@@ -0,0 +1,97 @@
+package scope
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// STRUCTURED CONCURRENCY
+// merge uses a WaitGroup and a context so no goroutine outlives the function that started it.
+// A scope makes that rule impossible to forget: goroutines can only be started inside a scope,
+// the scope doesn't return until every one of them has returned, and when one fails (error or panic)
+// the context of the others is cancelled. A panic is raised again in the goroutine that opened the scope.
+
+// Scope is the set of goroutines started inside Run
+type Scope struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+	panic  *PanicError
+}
+
+// PanicError is the value raised again by Run when a goroutine of the scope panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("scope: panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Run calls fn with a new scope and waits for every goroutine started in it,
+// it returns the first error (of fn or of a goroutine), or panics if a goroutine panicked
+func Run(ctx context.Context, fn func(ctx context.Context, s *Scope) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := &Scope{ctx: ctx, cancel: cancel}
+
+	s.fail(s.call(func() error { return fn(ctx, s) }))
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.panic != nil {
+		panic(s.panic)
+	}
+	return s.err
+}
+
+// Go starts fn in a new goroutine of the scope, it panics if the scope is already closed
+func (s *Scope) Go(fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		panic("scope: Go called after the scope was closed")
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		s.fail(s.call(func() error { return fn(s.ctx) }))
+	}()
+}
+
+// call runs fn turning a panic into a PanicError
+func (s *Scope) call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
+
+// fail records the first error (panics take precedence) and cancels the siblings
+func (s *Scope) fail(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if perr, ok := err.(*PanicError); ok && s.panic == nil {
+		s.panic = perr
+	}
+	if s.err == nil {
+		s.err = err
+	}
+	s.cancel()
+}
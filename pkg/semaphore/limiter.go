@@ -0,0 +1,51 @@
+package semaphore
+
+import "context"
+
+// CONCURRENCY LIMITER
+// The number of workers of a stage says how many values are processed at the same time, not how many calls
+// reach a dependency: a stage with 16 workers calling an API that accepts 4 connections needs its own cap.
+// A semaphore with 4 slots is that cap: Do wraps the call with a slot, so the slot is always given back
+// (even if the call panics) and several stages or pipelines can share the same semaphore.
+// Limiter is that semaphore when every call takes one slot.
+
+// Limiter caps the number of calls running at the same time
+type Limiter struct {
+	sem *Weighted
+}
+
+// NewLimiter creates a limiter for n concurrent calls
+func NewLimiter(n int) *Limiter {
+	return &Limiter{sem: New(int64(max(n, 1)))}
+}
+
+// Do calls fn once a slot is free and gives the slot back when fn returns,
+// it returns the context error without calling fn if the context is done while waiting
+func (l *Limiter) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return l.sem.Do(ctx, fn)
+}
+
+// Semaphore returns the semaphore of the limiter, to share it or to use it with Call
+func (l *Limiter) Semaphore() *Weighted {
+	return l.sem
+}
+
+// Do calls fn holding one slot and gives it back when fn returns,
+// it returns the context error without calling fn if the context is done while waiting for the slot
+func (s *Weighted) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := Call(ctx, s, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// Call runs fn holding one slot of s and returns its result, it's a function and not a method of Weighted
+// because methods can't have type parameters
+func Call[T any](ctx context.Context, s *Weighted, fn func(ctx context.Context) (T, error)) (T, error) {
+	if err := s.Acquire(ctx, 1); err != nil {
+		var zero T
+		return zero, err
+	}
+	defer s.Release(1)
+	return fn(ctx)
+}
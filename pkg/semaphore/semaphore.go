@@ -0,0 +1,115 @@
+package semaphore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// SEMAPHORE
+// A buffered channel is the simplest semaphore (send to acquire, receive to release)
+// but every slot has the same weight. A weighted semaphore lets a task take several slots at once
+// (a big file takes more memory than a small one). Waiters are served in order and every waiter
+// blocks on its own channel, so Acquire can listen to the context at the same time.
+
+// Weighted is a semaphore with a total capacity shared by weighted acquisitions
+type Weighted struct {
+	size    int64
+	cur     int64
+	mu      sync.Mutex
+	waiters list.List // of waiter, in arrival order
+}
+
+type waiter struct {
+	n     int64
+	ready chan struct{} // closed when the slots are acquired
+}
+
+// New creates a semaphore with the given capacity
+func New(n int64) *Weighted {
+	return &Weighted{size: n}
+}
+
+// Acquire takes n slots, blocking until they are available or the context is done,
+// on failure it returns the context error and takes nothing
+func (s *Weighted) Acquire(ctx context.Context, n int64) error {
+	s.mu.Lock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return nil
+	}
+
+	if n > s.size {
+		// it will never fit, don't make the other waiters wait behind it
+		s.mu.Unlock()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	w := waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-w.ready:
+			// acquired right after the context was done, give the slots back
+			s.cur -= n
+			s.notify()
+		default:
+			front := s.waiters.Front() == elem
+			s.waiters.Remove(elem)
+			if front && s.size > s.cur {
+				// it was blocking the waiters behind it
+				s.notify()
+			}
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes n slots only if they are available right away, it reports whether it did
+func (s *Weighted) TryAcquire(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size-s.cur >= n && s.waiters.Len() == 0 {
+		s.cur += n
+		return true
+	}
+	return false
+}
+
+// Release gives back n slots
+func (s *Weighted) Release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur -= n
+	if s.cur < 0 {
+		panic("semaphore: released more than held")
+	}
+	s.notify()
+}
+
+// notify wakes up the waiters in order while their slots fit
+func (s *Weighted) notify() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+		w := next.Value.(waiter)
+		if s.size-s.cur < w.n {
+			// the first waiter doesn't fit yet, the others keep their turn
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
@@ -0,0 +1,113 @@
+package shardmap_test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/shardmap"
+)
+
+// BENCHMARKS
+// Which map should a stage use for its shared state? It depends on how many keys there are and how often
+// they are written. Every workload runs the same operations (loads, stores and counter increments)
+// on a shardmap, a sync.Map and a map behind a mutex with b.RunParallel:
+// go test -bench Maps -benchmem ./pkg/shardmap
+
+func BenchmarkMaps(b *testing.B) {
+	for _, keys := range []int{16, 1000, 100000} {
+		for _, w := range []struct {
+			name   string
+			writes int  // percentage of the operations that write
+			count  bool // the writes increment a counter (read-modify-write) instead of storing a value
+		}{{"read mostly", 10, false}, {"write heavy", 50, false}, {"counters", 100, true}} {
+			for _, impl := range []string{"shardmap", "sync.Map", "mutex"} {
+				b.Run(fmt.Sprintf("%d keys/%s/%s", keys, w.name, impl), func(b *testing.B) {
+					benchmarkMap(b, newMap(impl), keys, w.writes, w.count)
+				})
+			}
+		}
+	}
+}
+
+func benchmarkMap(b *testing.B, m counters, keys, writes int, count bool) {
+	for k := range keys {
+		m.store(k)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			k := (i * 7919) % keys // spread the keys without sharing a random source
+			switch {
+			case i%100 >= writes:
+				m.load(k)
+			case count:
+				m.increment(k)
+			default:
+				m.store(k)
+			}
+			i++
+		}
+	})
+}
+
+// counters is the common shape of the implementations
+type counters interface {
+	load(k int)
+	store(k int)
+	increment(k int)
+}
+
+func newMap(impl string) counters {
+	switch impl {
+	case "sync.Map":
+		return &syncMap{}
+	case "mutex":
+		return &mutexMap{m: make(map[int]int64)}
+	}
+	return &shardedMap{m: shardmap.New[int, int64](0)}
+}
+
+type shardedMap struct{ m *shardmap.Map[int, int64] }
+
+func (s *shardedMap) load(k int)  { s.m.Load(k) }
+func (s *shardedMap) store(k int) { s.m.Store(k, int64(k)) }
+func (s *shardedMap) increment(k int) {
+	s.m.Upsert(k, 1, func(old int64) int64 { return old + 1 })
+}
+
+// syncMap keeps a pointer per key, the usual way to count with sync.Map
+type syncMap struct{ m sync.Map }
+
+func (s *syncMap) load(k int)  { s.m.Load(k) }
+func (s *syncMap) store(k int) { s.m.Store(k, new(atomic.Int64)) }
+func (s *syncMap) increment(k int) {
+	v, _ := s.m.LoadOrStore(k, new(atomic.Int64))
+	v.(*atomic.Int64).Add(1)
+}
+
+type mutexMap struct {
+	mu sync.RWMutex
+	m  map[int]int64
+}
+
+func (s *mutexMap) load(k int) {
+	s.mu.RLock()
+	_ = s.m[k]
+	s.mu.RUnlock()
+}
+
+func (s *mutexMap) store(k int) {
+	s.mu.Lock()
+	s.m[k] = int64(k)
+	s.mu.Unlock()
+}
+
+func (s *mutexMap) increment(k int) {
+	s.mu.Lock()
+	s.m[k]++
+	s.mu.Unlock()
+}
@@ -0,0 +1,273 @@
+package shardmap
+
+import (
+	"hash/maphash"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// SHARDED MAP
+// A map behind a single mutex serializes every worker of a stage that keeps shared state (counters, indexes).
+// sync.Map only shines when keys are written once and read many times. A sharded map splits the keys
+// between N maps with their own lock (by the hash of the key), so workers touching different keys rarely
+// wait for each other, and read-modify-write operations (Compute, Upsert) are atomic per key.
+// BenchmarkMaps compares it with sync.Map and a map with a mutex.
+
+// DefaultShards is the number of shards when New gets zero
+const DefaultShards = 32
+
+// Map is a concurrent map split in shards
+type Map[K comparable, V any] struct {
+	seed   maphash.Seed
+	hash   func(key K) uint64 // nil uses Hash
+	shards []shard[K, V]
+}
+
+type shard[K comparable, V any] struct {
+	mu sync.RWMutex
+	m  map[K]V
+	_  [32]byte // padding to 64 bytes, two shards don't share a cache line
+}
+
+// New creates a map with the given number of shards, DefaultShards if n is zero
+func New[K comparable, V any](n int) *Map[K, V] {
+	return NewWithHash[K, V](n, nil)
+}
+
+// NewWithHash is New with the function that picks the shard of a key, it must return the same value for equal keys,
+// a nil hash uses Hash, a hash written for the key type is faster for struct keys
+func NewWithHash[K comparable, V any](n int, hash func(key K) uint64) *Map[K, V] {
+	if n <= 0 {
+		n = DefaultShards
+	}
+	m := &Map[K, V]{seed: maphash.MakeSeed(), hash: hash, shards: make([]shard[K, V], n)}
+	for i := range m.shards {
+		m.shards[i].m = make(map[K]V)
+	}
+	return m
+}
+
+// Load returns the value of the key
+func (m *Map[K, V]) Load(key K) (V, bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.m[key]
+	return v, ok
+}
+
+// Store sets the value of the key
+func (m *Map[K, V]) Store(key K, v V) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = v
+}
+
+// Delete removes the key
+func (m *Map[K, V]) Delete(key K) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
+
+// Upsert stores insert if the key is missing or update(old) if it's present and returns the value stored,
+// update runs with the shard locked so it must be quick and must not use the map
+func (m *Map[K, V]) Upsert(key K, insert V, update func(old V) V) V {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[key]
+	if ok {
+		v = update(v)
+	} else {
+		v = insert
+	}
+	s.m[key] = v
+	return v
+}
+
+// Compute replaces the value of the key with the result of fn, which receives the current value (ok is false if missing),
+// the key is deleted if fn returns keep false, fn runs with the shard locked so it must be quick and must not use the map
+func (m *Map[K, V]) Compute(key K, fn func(old V, ok bool) (v V, keep bool)) (V, bool) {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.m[key]
+	v, keep := fn(old, ok)
+	if !keep {
+		delete(s.m, key)
+		var zero V
+		return zero, false
+	}
+	s.m[key] = v
+	return v, true
+}
+
+// Range calls fn for every key until it returns false, a shard is copied before fn is called for its keys
+// so fn can use the map, the changes made during Range may or may not be seen
+func (m *Map[K, V]) Range(fn func(key K, v V) bool) {
+	type kv struct {
+		k K
+		v V
+	}
+	var buf []kv
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		buf = buf[:0]
+		for k, v := range s.m {
+			buf = append(buf, kv{k, v})
+		}
+		s.mu.RUnlock()
+		for _, e := range buf {
+			if !fn(e.k, e.v) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of keys
+func (m *Map[K, V]) Len() int {
+	n := 0
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += len(s.m)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// shard returns the shard of the key
+func (m *Map[K, V]) shard(key K) *shard[K, V] {
+	var h uint64
+	if m.hash != nil {
+		h = m.hash(key)
+	} else {
+		h = Hash(m.seed, key)
+	}
+	return &m.shards[h%uint64(len(m.shards))]
+}
+
+// Hash hashes any comparable key, equal keys get the same hash,
+// strings, booleans and numbers are hashed without allocating, named types (type UserID string)
+// and structs, arrays, pointers or interfaces by their kind with reflect
+func Hash[K comparable](seed maphash.Seed, key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return maphash.String(seed, k)
+	case bool:
+		if k {
+			return mix(1)
+		}
+		return mix(0)
+	case int:
+		return mix(uint64(k))
+	case int8:
+		return mix(uint64(k))
+	case int16:
+		return mix(uint64(k))
+	case int32:
+		return mix(uint64(k))
+	case int64:
+		return mix(uint64(k))
+	case uint:
+		return mix(uint64(k))
+	case uint8:
+		return mix(uint64(k))
+	case uint16:
+		return mix(uint64(k))
+	case uint32:
+		return mix(uint64(k))
+	case uint64:
+		return mix(k)
+	case uintptr:
+		return mix(uint64(k))
+	case float32:
+		return hashFloat(float64(k))
+	case float64:
+		return hashFloat(k)
+	}
+	return hashValue(seed, reflect.ValueOf(key))
+}
+
+// hashValue hashes a key by its kind, named types included,
+// structs, arrays and interfaces are written field by field in a maphash.Hash
+func hashValue(seed maphash.Seed, v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0 // nil interface
+	case reflect.String:
+		return maphash.String(seed, v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			return mix(1)
+		}
+		return mix(0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return mix(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mix(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashFloat(v.Float())
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		return mix(uint64(v.Pointer()))
+	}
+	var h maphash.Hash
+	h.SetSeed(seed)
+	write(&h, v)
+	return h.Sum64()
+}
+
+// write adds a value to the hash by its kind, the hash of every field is written
+// so the padding between fields and the type of an interface don't matter
+func write(h *maphash.Hash, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			write(h, v.Field(i))
+		}
+	case reflect.Array:
+		for i := range v.Len() {
+			write(h, v.Index(i))
+		}
+	case reflect.Interface:
+		write(h, v.Elem())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeUint(h, hashFloat(real(c)))
+		writeUint(h, hashFloat(imag(c)))
+	default:
+		writeUint(h, hashValue(h.Seed(), v))
+	}
+}
+
+func writeUint(h *maphash.Hash, x uint64) {
+	var b [8]byte
+	for i := range b {
+		b[i] = byte(x >> (8 * i))
+	}
+	h.Write(b[:])
+}
+
+// hashFloat hashes the bits of a float, -0 is the same key as 0 (NaN is never equal to itself, any shard is fine)
+func hashFloat(f float64) uint64 {
+	if f == 0 {
+		f = 0
+	}
+	return mix(math.Float64bits(f))
+}
+
+// mix spreads the bits of an integer (splitmix64 finalizer) so consecutive keys land on different shards
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,94 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+)
+
+// SINGLE FLIGHT
+// When many workers need the same expensive value at the same time (same key, same database row...)
+// only the first one makes the call, the others wait for it and get the same result.
+// The call runs in its own goroutine with a context that only ends when every caller has given up,
+// so a cancelled caller doesn't fail the call for the ones still waiting.
+
+// Group coalesces concurrent calls with the same key, the zero value is ready to use
+type Group[K comparable, V any] struct {
+	// IsolateErrors makes every caller that joined a failed call make its own call instead of getting the error
+	IsolateErrors bool
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done    chan struct{} // closed when val and err are set
+	val     V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do returns the result of fn for the key, if a call for the key is in flight it waits for that call instead,
+// fn receives a context that keeps the values of the first caller and is cancelled when every caller has given up
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(context.Context) (V, error)) (V, error) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[K]*call[V])
+		}
+		c, joined := g.calls[key]
+		if !joined {
+			callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+			c = &call[V]{done: make(chan struct{}), cancel: cancel}
+			g.calls[key] = c
+			go g.run(callCtx, key, c, fn)
+		}
+		c.waiters++
+		g.mu.Unlock()
+
+		select {
+		case <-c.done:
+			if c.err != nil && joined && g.IsolateErrors {
+				continue // not our call, try on our own
+			}
+			return c.val, c.err
+		case <-ctx.Done():
+			g.leave(key, c)
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Forget makes the next call for the key start a new call even if one is in flight
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.calls, key)
+}
+
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(context.Context) (V, error)) {
+	defer c.cancel()
+	val, err := fn(ctx)
+
+	g.mu.Lock()
+	c.val, c.err = val, err
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// leave removes a caller that gave up, the call is cancelled when nobody is waiting for it anymore
+func (g *Group[K, V]) leave(key K, c *call[V]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 {
+		c.cancel()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	}
+}
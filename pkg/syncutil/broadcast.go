@@ -0,0 +1,50 @@
+package syncutil
+
+import (
+	"context"
+	"sync"
+)
+
+// BROADCAST
+// sync.Cond wakes up every waiter with Broadcast, but Wait can't be used in a select,
+// so a waiter can't also listen to its context. Closing a channel wakes up every receiver at once
+// and works in a select: Done returns the channel of the current round, Broadcast closes it
+// and arms a new one for the next round (e.g. every stage waiting for a restart).
+
+// Broadcast releases every goroutine waiting for it at once, it can be used again after every Broadcast,
+// the zero value is ready to use
+type Broadcast struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// Done returns a channel closed by the next call to Broadcast
+func (b *Broadcast) Done() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		b.ch = make(chan struct{})
+	}
+	return b.ch
+}
+
+// Wait blocks until the next call to Broadcast or until the context is done
+func (b *Broadcast) Wait(ctx context.Context) error {
+	select {
+	case <-b.Done():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Broadcast releases every goroutine waiting and re-arms, the goroutines that start waiting after it
+// wait for the next one
+func (b *Broadcast) Broadcast() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch != nil {
+		close(b.ch)
+	}
+	b.ch = make(chan struct{})
+}
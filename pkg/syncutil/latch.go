@@ -0,0 +1,114 @@
+package syncutil
+
+import (
+	"context"
+	"sync"
+)
+
+// LATCHES AND BARRIERS
+// Sometimes several stages must reach the same point before any of them goes on (e.g. the end of a window).
+// A latch is a one-shot gate: it opens once it has been counted down n times, and stays open.
+// A barrier is reusable: the n-th goroutine to arrive releases the n-1 already waiting and the barrier
+// starts counting again for the next round (cyclic). Both wait with a context.
+
+// CountDownLatch opens once CountDown has been called n times
+type CountDownLatch struct {
+	mu    sync.Mutex
+	count int
+	done  chan struct{}
+}
+
+// NewCountDownLatch creates a latch that opens after n calls to CountDown, it's already open if n <= 0
+func NewCountDownLatch(n int) *CountDownLatch {
+	l := &CountDownLatch{count: max(n, 0), done: make(chan struct{})}
+	if l.count == 0 {
+		close(l.done)
+	}
+	return l
+}
+
+// CountDown decrements the count and opens the latch when it reaches zero, calls after that do nothing
+func (l *CountDownLatch) CountDown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count == 0 {
+		return
+	}
+	l.count--
+	if l.count == 0 {
+		close(l.done)
+	}
+}
+
+// Count returns the number of calls to CountDown still needed to open the latch
+func (l *CountDownLatch) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Done returns a channel closed when the latch opens
+func (l *CountDownLatch) Done() <-chan struct{} {
+	return l.done
+}
+
+// Wait blocks until the latch opens or the context is done
+func (l *CountDownLatch) Wait(ctx context.Context) error {
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Barrier makes a fixed number of goroutines wait for each other, round after round
+type Barrier struct {
+	parties int
+
+	mu      sync.Mutex
+	waiting int
+	round   chan struct{} // closed when the current round is complete
+}
+
+// NewBarrier creates a barrier for the given number of goroutines
+func NewBarrier(parties int) *Barrier {
+	return &Barrier{parties: max(parties, 1), round: make(chan struct{})}
+}
+
+// Wait blocks until parties goroutines have called Wait in this round, the last one releases all of them,
+// a goroutine whose context is done leaves the round (it no longer counts) and gets the context error
+func (b *Barrier) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	b.waiting++
+	if b.waiting == b.parties {
+		// the round is complete, the next one starts from zero
+		close(b.round)
+		b.round = make(chan struct{})
+		b.waiting = 0
+		b.mu.Unlock()
+		return nil
+	}
+	round := b.round
+	b.mu.Unlock()
+
+	select {
+	case <-round:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.round != round {
+			return nil // the round completed while the context was being done
+		}
+		b.waiting--
+		return ctx.Err()
+	}
+}
+
+// Waiting returns the number of goroutines waiting in the current round
+func (b *Barrier) Waiting() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.waiting
+}
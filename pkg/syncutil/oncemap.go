@@ -0,0 +1,94 @@
+package syncutil
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/group"
+)
+
+// ONCE PER KEY
+// sync.Once runs a function once, but stage workers usually need something once per key:
+// one connection per shard, one file per partition. OnceMap runs the initialization of a key exactly once
+// even when many workers ask for it at the same time, the others wait for it (with their context)
+// and every later call gets the same result. Unlike singleflight the result is kept, errors included,
+// until the key is forgotten.
+
+// OnceMap keeps the result of the initialization of every key, the zero value is ready to use
+type OnceMap[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]*once[V]
+}
+
+type once[V any] struct {
+	done chan struct{} // closed when val and err are set
+	val  V
+	err  error
+}
+
+// Do returns the result of the initialization of the key, running fn if it's the first call for the key,
+// fn runs in its own goroutine with the values of ctx but is not cancelled with it, a caller whose context
+// is done stops waiting and gets the context error, the initialization goes on for the others
+func (m *OnceMap[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (V, error) {
+	m.mu.Lock()
+	if m.entries == nil {
+		m.entries = make(map[K]*once[V])
+	}
+	e, ok := m.entries[key]
+	if !ok {
+		e = &once[V]{done: make(chan struct{})}
+		m.entries[key] = e
+		go e.run(context.WithoutCancel(ctx), fn)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return e.val, e.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// run calls fn, a panic is kept as a *group.PanicError
+func (e *once[V]) run(ctx context.Context, fn func(context.Context) (V, error)) {
+	defer close(e.done)
+	defer func() {
+		if r := recover(); r != nil {
+			e.err = &group.PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	e.val, e.err = fn(ctx)
+}
+
+// Forget removes the result of the key so the next call to Do initializes it again (e.g. after an error),
+// the callers waiting for an initialization in flight still get its result
+func (m *OnceMap[K, V]) Forget(key K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
+
+// Range calls fn for every key initialized without error until fn returns false (e.g. to close the connections)
+func (m *OnceMap[K, V]) Range(fn func(key K, v V) bool) {
+	m.mu.Lock()
+	done := make(map[K]*once[V], len(m.entries))
+	for k, e := range m.entries {
+		select {
+		case <-e.done:
+			if e.err == nil {
+				done[k] = e
+			}
+		default: // still initializing
+		}
+	}
+	m.mu.Unlock()
+
+	for k, e := range done {
+		if !fn(k, e.val) {
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package syncutil
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+
+	"github.com/alejandro-curci/golang-talk-concurrency/pkg/group"
+)
+
+// WAIT GROUP
+// sync.WaitGroup.Wait blocks forever if a goroutine never calls Done (a merge whose input is never closed),
+// and the errors of the goroutines have to be collected by hand. This WaitGroup starts the goroutines itself,
+// keeps every error they return (and every panic, as a *group.PanicError) and can stop waiting when a context is done.
+// Unlike group.Group it doesn't cancel anything: every goroutine runs to the end and every error is reported.
+
+// WaitGroup waits for a collection of goroutines and joins their errors, the zero value is ready to use
+type WaitGroup struct {
+	mu      sync.Mutex
+	running int
+	done    chan struct{} // closed when running drops to zero, every Wait shares it
+	errs    []error
+}
+
+// Go runs fn in a new goroutine, its error (or its panic) is returned by Wait
+func (g *WaitGroup) Go(fn func() error) {
+	g.mu.Lock()
+	if g.running == 0 {
+		g.done = make(chan struct{}) // the previous one, if any, is already closed
+	}
+	g.running++
+	g.mu.Unlock()
+
+	go func() {
+		err := call(fn)
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if err != nil {
+			g.errs = append(g.errs, err)
+		}
+		if g.running--; g.running == 0 {
+			close(g.done)
+		}
+	}()
+}
+
+// Wait blocks until every goroutine has returned and returns their errors joined,
+// if the context is done first it returns the context error and the goroutines keep running
+func (g *WaitGroup) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	done := g.done
+	g.mu.Unlock()
+	if done != nil { // nil if Go was never called
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err() // nothing is left waiting behind
+		}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return errors.Join(g.errs...)
+}
+
+// call runs fn turning a panic into a *group.PanicError
+func call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &group.PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,206 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WORKER POOL
+// A fixed number of goroutines pick tasks from a bounded queue.
+// It puts a limit on the goroutines a program creates (instead of one per task)
+// and gives a single place to decide what happens when the workers can't keep up.
+
+var (
+	// ErrQueueFull is returned by Submit when the queue is full and the overflow policy is Reject
+	ErrQueueFull = errors.New("workerpool: queue is full")
+	// ErrClosed is returned by Submit after the pool has been shut down
+	ErrClosed = errors.New("workerpool: pool is closed")
+)
+
+// Task is a unit of work, it must return as soon as its context is done
+type Task func(ctx context.Context) error
+
+// Policy decides what Submit does when the queue is full
+type Policy int
+
+const (
+	// Block waits until there is room in the queue
+	Block Policy = iota
+	// Drop discards the task silently (it's counted in Dropped)
+	Drop
+	// Reject discards the task and returns ErrQueueFull
+	Reject
+)
+
+// Option configures a pool
+type Option func(*Pool)
+
+// WithQueueSize sets how many tasks can wait for a free worker (zero means a task waits for a worker)
+func WithQueueSize(n int) Option {
+	return func(p *Pool) {
+		if n > 0 {
+			p.queueSize = n
+		}
+	}
+}
+
+// WithOverflow sets the policy used when the queue is full, Block by default
+func WithOverflow(policy Policy) Option {
+	return func(p *Pool) {
+		p.overflow = policy
+	}
+}
+
+// WithTaskTimeout gives every task its own deadline
+func WithTaskTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.timeout = d
+	}
+}
+
+// WithErrorHandler sets the function called with the error of every failed task
+func WithErrorHandler(fn func(error)) Option {
+	return func(p *Pool) {
+		p.onError = fn
+	}
+}
+
+// Pool runs tasks on a fixed number of goroutines
+type Pool struct {
+	queueSize int
+	overflow  Policy
+	timeout   time.Duration
+	onError   func(error)
+
+	tasks  chan Task
+	quit   chan struct{} // closed on shutdown to wake up blocked submitters
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.RWMutex
+	closed  bool
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// New starts a pool with the given number of workers
+func New(workers int, opts ...Option) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &Pool{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.tasks = make(chan Task, p.queueSize)
+	p.quit = make(chan struct{})
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues a task, the context only bounds the wait for a free slot, not the task itself
+func (p *Pool) Submit(ctx context.Context, t Task) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+
+	switch p.overflow {
+	case Drop, Reject:
+		select {
+		case p.tasks <- t:
+			return nil
+		default:
+			if p.overflow == Reject {
+				return ErrQueueFull
+			}
+			p.dropped.Add(1)
+			return nil
+		}
+	default:
+		select {
+		case p.tasks <- t:
+			return nil
+		case <-p.quit:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Dropped returns the number of tasks discarded by the Drop policy
+func (p *Pool) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+// Shutdown stops accepting tasks and waits for the queued and running ones to finish,
+// if the context is done first the running tasks are cancelled and the context error is returned
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.close()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel() // tasks still in the queue are skipped
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Stop cancels the running tasks, skips the queued ones and waits for the workers to exit
+func (p *Pool) Stop() {
+	p.cancel()
+	p.close()
+	p.wg.Wait()
+}
+
+func (p *Pool) close() {
+	p.once.Do(func() {
+		close(p.quit)
+		p.mu.Lock() // waits for the submitters that are still inside Submit
+		p.closed = true
+		close(p.tasks)
+		p.mu.Unlock()
+	})
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.tasks {
+		if p.ctx.Err() != nil {
+			continue // hard stop, drain the queue without running anything
+		}
+		p.run(t)
+	}
+}
+
+func (p *Pool) run(t Task) {
+	ctx := p.ctx
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+	if err := t(ctx); err != nil && p.onError != nil {
+		p.onError(err)
+	}
+}